@@ -2,6 +2,7 @@ package db
 
 import (
     "database/sql"
+    "strconv"
     _ "github.com/mattn/go-sqlite3"
     "WebdavSync/models" // 添加 models 导入
 )
@@ -19,17 +20,14 @@ func NewDB(path string) (*DB, error) {
     }
 
     _, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS files (
-            path TEXT PRIMARY KEY,
-            local_hash TEXT,
-            remote_hash TEXT,
-            local_mtime INTEGER,
-            remote_mtime INTEGER,
-            last_sync INTEGER,
-            status TEXT
+        CREATE TABLE IF NOT EXISTS profiles (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL
         );
+        CREATE TABLE IF NOT EXISTS ` + filesTable + `;
         CREATE TABLE IF NOT EXISTS tasks (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
+            profile_id INTEGER NOT NULL DEFAULT 1,
             path TEXT,
             operation TEXT,
             status TEXT,
@@ -37,44 +35,287 @@ func NewDB(path string) (*DB, error) {
             last_attempt INTEGER,
             chunk_offset INTEGER
         );
-        CREATE TABLE IF NOT EXISTS config (
+        CREATE TABLE IF NOT EXISTS ` + configTable + `;
+        CREATE TABLE IF NOT EXISTS accounts (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL,
+            url TEXT NOT NULL,
+            user TEXT NOT NULL,
+            pass TEXT NOT NULL,
+            auth_type TEXT NOT NULL DEFAULT 'basic',
+            token TEXT NOT NULL DEFAULT '',
+            token_url TEXT NOT NULL DEFAULT '',
+            client_id TEXT NOT NULL DEFAULT '',
+            client_secret TEXT NOT NULL DEFAULT '',
+            ca_cert TEXT NOT NULL DEFAULT '',
+            client_cert TEXT NOT NULL DEFAULT '',
+            client_key TEXT NOT NULL DEFAULT '',
+            pin_sha256 TEXT NOT NULL DEFAULT '',
+            insecure INTEGER NOT NULL DEFAULT 0,
+            proxy_mode TEXT NOT NULL DEFAULT 'system',
+            proxy_url TEXT NOT NULL DEFAULT '',
+            proxy_user TEXT NOT NULL DEFAULT '',
+            proxy_pass TEXT NOT NULL DEFAULT ''
+        );
+        CREATE TABLE IF NOT EXISTS settings (
             key TEXT PRIMARY KEY,
-            value TEXT
+            value TEXT NOT NULL
+        );
+        CREATE TABLE IF NOT EXISTS vault (
+            key TEXT PRIMARY KEY,
+            value TEXT NOT NULL
+        );
+        CREATE TABLE IF NOT EXISTS hash_cache (
+            profile_id INTEGER NOT NULL,
+            path TEXT NOT NULL,
+            size INTEGER NOT NULL,
+            mtime INTEGER NOT NULL,
+            inode INTEGER NOT NULL,
+            device INTEGER NOT NULL,
+            algorithm TEXT NOT NULL,
+            hash TEXT NOT NULL,
+            PRIMARY KEY (profile_id, path)
+        );
+        CREATE TABLE IF NOT EXISTS block_signatures (
+            profile_id INTEGER NOT NULL,
+            path TEXT NOT NULL,
+            size INTEGER NOT NULL,
+            block_size INTEGER NOT NULL,
+            remote_tag TEXT NOT NULL,
+            blocks BLOB NOT NULL,
+            PRIMARY KEY (profile_id, path)
+        );
+        CREATE TABLE IF NOT EXISTS trash (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            profile_id INTEGER NOT NULL DEFAULT 1,
+            path TEXT,
+            trash_path TEXT,
+            deleted_at INTEGER,
+            size INTEGER
         );
     `)
     if err != nil {
         return nil, err
     }
 
+    if err := addColumn(db, "files", "skip_reason", "TEXT NOT NULL DEFAULT ''"); err != nil {
+        return nil, err
+    }
+    if err := addColumn(db, "files", "local_size", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+        return nil, err
+    }
+    for _, column := range []string{"token", "token_url", "client_id", "client_secret", "ca_cert", "client_cert", "client_key", "pin_sha256",
+        "proxy_url", "proxy_user", "proxy_pass"} {
+        if err := addColumn(db, "accounts", column, "TEXT NOT NULL DEFAULT ''"); err != nil {
+            return nil, err
+        }
+    }
+    if err := addColumn(db, "accounts", "auth_type", "TEXT NOT NULL DEFAULT 'basic'"); err != nil {
+        return nil, err
+    }
+    if err := addColumn(db, "accounts", "insecure", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+        return nil, err
+    }
+    if err := addColumn(db, "accounts", "proxy_mode", "TEXT NOT NULL DEFAULT 'system'"); err != nil {
+        return nil, err
+    }
+    if err := migrateProfiles(db); err != nil {
+        return nil, err
+    }
+    if err := migrateAccounts(db); err != nil {
+        return nil, err
+    }
+    // 首次运行时创建默认同步对
+    _, err = db.Exec("INSERT INTO profiles (id, name) SELECT 1, '默认' WHERE NOT EXISTS (SELECT 1 FROM profiles)")
+    if err != nil {
+        return nil, err
+    }
+
     return &DB{db}, nil
 }
 
+const filesTable = `files (
+            profile_id INTEGER NOT NULL DEFAULT 1,
+            path TEXT,
+            local_hash TEXT,
+            remote_hash TEXT,
+            local_mtime INTEGER,
+            remote_mtime INTEGER,
+            last_sync INTEGER,
+            status TEXT,
+            skip_reason TEXT NOT NULL DEFAULT '',
+            local_size INTEGER NOT NULL DEFAULT 0,
+            PRIMARY KEY (profile_id, path)
+        )`
+
+const configTable = `config (
+            profile_id INTEGER NOT NULL DEFAULT 1,
+            key TEXT,
+            value TEXT,
+            PRIMARY KEY (profile_id, key)
+        )`
+
+// migrateProfiles 将只支持单个同步对的旧数据库迁移为多同步对结构，旧数据归入 1 号同步对
+func migrateProfiles(db *sql.DB) error {
+    migrated, err := hasColumn(db, "files", "profile_id")
+    if err != nil || migrated {
+        return err
+    }
+    if err := addColumn(db, "tasks", "profile_id", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+        return err
+    }
+    if err := addColumn(db, "trash", "profile_id", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+        return err
+    }
+
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    // files 和 config 的主键需要加入 profile_id，只能重建表
+    stmts := []string{
+        "ALTER TABLE files RENAME TO files_old",
+        "CREATE TABLE " + filesTable,
+        `INSERT INTO files (profile_id, path, local_hash, remote_hash, local_mtime, remote_mtime, last_sync, status, skip_reason)
+            SELECT 1, path, local_hash, remote_hash, local_mtime, remote_mtime, last_sync, status, skip_reason FROM files_old`,
+        "DROP TABLE files_old",
+        "ALTER TABLE config RENAME TO config_old",
+        "CREATE TABLE " + configTable,
+        "INSERT INTO config (profile_id, key, value) SELECT 1, key, value FROM config_old",
+        "DROP TABLE config_old",
+        "INSERT OR IGNORE INTO profiles (id, name) VALUES (1, '默认')",
+    }
+    for _, stmt := range stmts {
+        if _, err := tx.Exec(stmt); err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
+}
+
+// migrateAccounts 将同步对配置中的 url/user/pass 迁移到 accounts 表，相同凭据的同步对共用一个账户
+func migrateAccounts(db *sql.DB) error {
+    rows, err := db.Query(`SELECT profile_id,
+            MAX(CASE WHEN key = 'url' THEN value END),
+            COALESCE(MAX(CASE WHEN key = 'user' THEN value END), ''),
+            COALESCE(MAX(CASE WHEN key = 'pass' THEN value END), '')
+        FROM config WHERE key IN ('url', 'user', 'pass') GROUP BY profile_id`)
+    if err != nil {
+        return err
+    }
+    type legacy struct {
+        profileID       int64
+        url, user, pass sql.NullString
+    }
+    var profiles []legacy
+    for rows.Next() {
+        var l legacy
+        if err := rows.Scan(&l.profileID, &l.url, &l.user, &l.pass); err != nil {
+            rows.Close()
+            return err
+        }
+        profiles = append(profiles, l)
+    }
+    rows.Close()
+    if len(profiles) == 0 {
+        return nil
+    }
+
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    for _, l := range profiles {
+        if l.url.String != "" {
+            var accountID int64
+            err := tx.QueryRow("SELECT id FROM accounts WHERE url = ? AND user = ? AND pass = ?", l.url.String, l.user.String, l.pass.String).Scan(&accountID)
+            if err == sql.ErrNoRows {
+                name := l.url.String
+                if l.user.String != "" {
+                    name = l.user.String + "@" + l.url.String
+                }
+                res, err := tx.Exec("INSERT INTO accounts (name, url, user, pass) VALUES (?, ?, ?, ?)", name, l.url.String, l.user.String, l.pass.String)
+                if err != nil {
+                    return err
+                }
+                if accountID, err = res.LastInsertId(); err != nil {
+                    return err
+                }
+            } else if err != nil {
+                return err
+            }
+            if _, err := tx.Exec("INSERT OR REPLACE INTO config (profile_id, key, value) VALUES (?, 'account_id', ?)", l.profileID, strconv.FormatInt(accountID, 10)); err != nil {
+                return err
+            }
+        }
+        if _, err := tx.Exec("DELETE FROM config WHERE profile_id = ? AND key IN ('url', 'user', 'pass')", l.profileID); err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
+}
+
+// hasColumn 判断表中是否已有指定的列
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+    rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+    if err != nil {
+        return false, err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil {
+            return false, err
+        }
+        if name == column {
+            return true, nil
+        }
+    }
+    return false, rows.Err()
+}
+
+// addColumn 为已有的表补充新增的列，列已存在时不做任何操作
+func addColumn(db *sql.DB, table, column, definition string) error {
+    exists, err := hasColumn(db, table, column)
+    if err != nil || exists {
+        return err
+    }
+    _, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+    return err
+}
+
 // SaveFile 保存文件信息
 func (d *DB) SaveFile(file models.FileInfo) error {
     _, err := d.Exec(`
-        INSERT OR REPLACE INTO files (path, local_hash, remote_hash, local_mtime, remote_mtime, last_sync, status)
-        VALUES (?, ?, ?, ?, ?, ?, ?)
-    `, file.Path, file.LocalHash, file.RemoteHash, file.LocalMtime, file.RemoteMtime, file.LastSync, file.Status)
+        INSERT OR REPLACE INTO files (profile_id, path, local_hash, remote_hash, local_mtime, remote_mtime, last_sync, status, skip_reason)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, file.ProfileID, file.Path, file.LocalHash, file.RemoteHash, file.LocalMtime, file.RemoteMtime, file.LastSync, file.Status, file.SkipReason)
     return err
 }
 
 // GetFile 获取文件信息
-func (d *DB) GetFile(path string) (models.FileInfo, error) {
+func (d *DB) GetFile(profileID int64, path string) (models.FileInfo, error) {
     var file models.FileInfo
     row := d.QueryRow(`
-        SELECT path, local_hash, remote_hash, local_mtime, remote_mtime, last_sync, status
-        FROM files WHERE path = ?
-    `, path)
-    err := row.Scan(&file.Path, &file.LocalHash, &file.RemoteHash, &file.LocalMtime, &file.RemoteMtime, &file.LastSync, &file.Status)
+        SELECT profile_id, path, COALESCE(local_hash, ''), COALESCE(remote_hash, ''), COALESCE(local_mtime, 0),
+            COALESCE(remote_mtime, 0), COALESCE(last_sync, 0), status, skip_reason
+        FROM files WHERE profile_id = ? AND path = ?
+    `, profileID, path)
+    err := row.Scan(&file.ProfileID, &file.Path, &file.LocalHash, &file.RemoteHash, &file.LocalMtime, &file.RemoteMtime, &file.LastSync, &file.Status, &file.SkipReason)
     return file, err
 }
 
-// GetFiles 获取所有文件
-func (d *DB) GetFiles() ([]models.FileInfo, error) {
+// GetFiles 获取同步对的所有文件
+func (d *DB) GetFiles(profileID int64) ([]models.FileInfo, error) {
     rows, err := d.Query(`
-        SELECT path, local_hash, remote_hash, local_mtime, remote_mtime, last_sync, status
-        FROM files
-    `)
+        SELECT profile_id, path, COALESCE(local_hash, ''), COALESCE(remote_hash, ''), COALESCE(local_mtime, 0),
+            COALESCE(remote_mtime, 0), COALESCE(last_sync, 0), status, skip_reason
+        FROM files WHERE profile_id = ?
+    `, profileID)
     if err != nil {
         return nil, err
     }
@@ -83,7 +324,7 @@ func (d *DB) GetFiles() ([]models.FileInfo, error) {
     var files []models.FileInfo
     for rows.Next() {
         var file models.FileInfo
-        if err := rows.Scan(&file.Path, &file.LocalHash, &file.RemoteHash, &file.LocalMtime, &file.RemoteMtime, &file.LastSync, &file.Status); err != nil {
+        if err := rows.Scan(&file.ProfileID, &file.Path, &file.LocalHash, &file.RemoteHash, &file.LocalMtime, &file.RemoteMtime, &file.LastSync, &file.Status, &file.SkipReason); err != nil {
             return nil, err
         }
         files = append(files, file)
@@ -94,29 +335,29 @@ func (d *DB) GetFiles() ([]models.FileInfo, error) {
 // SaveTask 保存任务
 func (d *DB) SaveTask(task models.Task) error {
     _, err := d.Exec(`
-        INSERT OR REPLACE INTO tasks (id, path, operation, status, retries, last_attempt, chunk_offset)
-        VALUES (?, ?, ?, ?, ?, ?, ?)
-    `, task.ID, task.Path, task.Operation, task.Status, task.Retries, task.LastAttempt, task.ChunkOffset)
+        INSERT OR REPLACE INTO tasks (id, profile_id, path, operation, status, retries, last_attempt, chunk_offset)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `, task.ID, task.ProfileID, task.Path, task.Operation, task.Status, task.Retries, task.LastAttempt, task.ChunkOffset)
     return err
 }
 
 // GetTask 获取任务
-func (d *DB) GetTask(path, operation string) (models.Task, error) {
+func (d *DB) GetTask(profileID int64, path, operation string) (models.Task, error) {
     var task models.Task
     row := d.QueryRow(`
-        SELECT id, path, operation, status, retries, last_attempt, chunk_offset
-        FROM tasks WHERE path = ? AND operation = ?
-    `, path, operation)
-    err := row.Scan(&task.ID, &task.Path, &task.Operation, &task.Status, &task.Retries, &task.LastAttempt, &task.ChunkOffset)
+        SELECT id, profile_id, path, operation, status, retries, last_attempt, chunk_offset
+        FROM tasks WHERE profile_id = ? AND path = ? AND operation = ?
+    `, profileID, path, operation)
+    err := row.Scan(&task.ID, &task.ProfileID, &task.Path, &task.Operation, &task.Status, &task.Retries, &task.LastAttempt, &task.ChunkOffset)
     return task, err
 }
 
-// GetPendingTasks 获取待处理任务
-func (d *DB) GetPendingTasks() ([]models.Task, error) {
+// GetPendingTasks 获取同步对的待处理任务
+func (d *DB) GetPendingTasks(profileID int64) ([]models.Task, error) {
     rows, err := d.Query(`
-        SELECT id, path, operation, status, retries, last_attempt, chunk_offset
-        FROM tasks WHERE status = 'pending'
-    `)
+        SELECT id, profile_id, path, operation, status, retries, last_attempt, chunk_offset
+        FROM tasks WHERE profile_id = ? AND status = 'pending'
+    `, profileID)
     if err != nil {
         return nil, err
     }
@@ -125,7 +366,7 @@ func (d *DB) GetPendingTasks() ([]models.Task, error) {
     var tasks []models.Task
     for rows.Next() {
         var task models.Task
-        if err := rows.Scan(&task.ID, &task.Path, &task.Operation, &task.Status, &task.Retries, &task.LastAttempt, &task.ChunkOffset); err != nil {
+        if err := rows.Scan(&task.ID, &task.ProfileID, &task.Path, &task.Operation, &task.Status, &task.Retries, &task.LastAttempt, &task.ChunkOffset); err != nil {
             return nil, err
         }
         tasks = append(tasks, task)
@@ -0,0 +1,241 @@
+package engine
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/studio-b12/gowebdav"
+    "WebdavSync/models"
+)
+
+// Connection 是一个账户的共享连接，使用同一账户的同步对共用连接池、认证状态和 TLS 设置
+type Connection struct {
+    Client    *gowebdav.Client  // WebDAV 客户端
+    Transport http.RoundTripper // WebDAV 客户端使用的传输层，其他 HTTP 请求也应经由它发出
+
+    account models.Account
+    base    *http.Transport     // 未经熔断器包装的传输层，提供 TLS 和代理设置
+    auth    gowebdav.Authorizer // 与 Client 共用的认证状态
+    http    *http.Client
+}
+
+// NewConnection 按账户的 TLS 设置和认证方式创建连接。onRefresh 在 OAuth2 刷新令牌轮换后调用，用于持久化新令牌
+func NewConnection(account models.Account, onRefresh func(refreshToken string)) (*Connection, error) {
+    transport, err := NewTransport(account)
+    if err != nil {
+        return nil, err
+    }
+    // 所有请求经由同一个熔断器，任一同步对触发限流时其他同步对也会暂停请求
+    shared := newBreaker(transport)
+    auth := newAuthorizer(account, onRefresh)
+    client := gowebdav.NewAuthClient(account.URL, auth)
+    client.SetTransport(shared)
+    return &Connection{
+        Client:    client,
+        Transport: shared,
+        account:   account,
+        base:      transport,
+        auth:      auth,
+        http:      &http.Client{Transport: shared},
+    }, nil
+}
+
+// Do 发送 gowebdav 不支持的 WebDAV 请求（如 REPORT），与 Client 共用认证和传输层。
+// path 相对于账户 URL，调用方负责关闭响应体
+func (c *Connection) Do(method, path string, body []byte, header http.Header) (*http.Response, error) {
+    return c.do(method, gowebdav.PathEscape(gowebdav.Join(c.account.URL, path)), path, body, header)
+}
+
+// do 向完整的 uri 发送请求，path 用于认证器的错误信息
+func (c *Connection) do(method, uri, path string, body []byte, header http.Header) (*http.Response, error) {
+    auth, reader := c.auth.NewAuthenticator(bytes.NewReader(body))
+    defer auth.Close()
+    for {
+        rq, err := http.NewRequest(method, uri, reader)
+        if err != nil {
+            return nil, err
+        }
+        for key, values := range header {
+            rq.Header[key] = values
+        }
+        if err := auth.Authorize(c.http, rq, path); err != nil {
+            return nil, err
+        }
+        rs, err := c.http.Do(rq)
+        if err != nil {
+            return nil, err
+        }
+        redo, err := auth.Verify(c.http, rs, path)
+        if err != nil {
+            rs.Body.Close()
+            return nil, err
+        }
+        if !redo {
+            return rs, nil
+        }
+        // 认证协商需要重发请求，例如收到 Digest 质询后
+        rs.Body.Close()
+        reader = bytes.NewReader(body)
+    }
+}
+
+// newAuthorizer 按账户的认证方式创建 WebDAV 认证器
+func newAuthorizer(account models.Account, onRefresh func(refreshToken string)) gowebdav.Authorizer {
+    switch account.AuthType {
+    case "digest":
+        auth := gowebdav.NewEmptyAuth()
+        auth.AddAuthenticator("digest", func(c *http.Client, rs *http.Response, path string) (gowebdav.Authenticator, error) {
+            return gowebdav.NewDigestAuth(account.User, account.Pass, rs)
+        })
+        return auth
+    case "bearer":
+        return gowebdav.NewPreemptiveAuth(&bearerAuth{token: account.Token})
+    case "oauth2":
+        auth := &oauth2Auth{
+            tokenURL:     account.TokenURL,
+            clientID:     account.ClientID,
+            clientSecret: account.ClientSecret,
+            refreshToken: account.Token,
+            onRefresh:    onRefresh,
+        }
+        return gowebdav.NewPreemptiveAuth(auth)
+    }
+    // basic：根据服务器的 WWW-Authenticate 自动协商，Nextcloud 应用密码也使用此方式
+    return gowebdav.NewAutoAuth(account.User, account.Pass)
+}
+
+// bearerAuth 在每个请求中携带固定的 Bearer 令牌
+type bearerAuth struct {
+    token string
+}
+
+func (b *bearerAuth) Authorize(c *http.Client, rq *http.Request, path string) error {
+    rq.Header.Set("Authorization", "Bearer "+b.token)
+    return nil
+}
+
+func (b *bearerAuth) Verify(c *http.Client, rs *http.Response, path string) (redo bool, err error) {
+    if rs.StatusCode == http.StatusUnauthorized {
+        err = gowebdav.NewPathError("Authorize", path, rs.StatusCode)
+    }
+    return
+}
+
+func (b *bearerAuth) Close() error {
+    return nil
+}
+
+func (b *bearerAuth) Clone() gowebdav.Authenticator {
+    return b
+}
+
+func (b *bearerAuth) String() string {
+    return "BearerAuth"
+}
+
+// oauth2Auth 使用刷新令牌获取访问令牌，并在过期前或被服务器拒绝后自动续期。
+// 所有请求共享同一个实例，令牌状态由 mu 保护。
+type oauth2Auth struct {
+    tokenURL     string
+    clientID     string
+    clientSecret string
+    onRefresh    func(refreshToken string)
+
+    mu           sync.Mutex
+    refreshToken string
+    accessToken  string
+    expiry       time.Time
+}
+
+// oauth2Token 是令牌端点返回的 JSON
+type oauth2Token struct {
+    AccessToken  string `json:"access_token"`
+    RefreshToken string `json:"refresh_token"`
+    ExpiresIn    int64  `json:"expires_in"`
+}
+
+func (o *oauth2Auth) Authorize(c *http.Client, rq *http.Request, path string) error {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    // 提前一分钟续期，避免令牌在请求途中过期
+    if o.accessToken == "" || (!o.expiry.IsZero() && time.Now().Add(time.Minute).After(o.expiry)) {
+        if err := o.refresh(c); err != nil {
+            return err
+        }
+    }
+    rq.Header.Set("Authorization", "Bearer "+o.accessToken)
+    return nil
+}
+
+func (o *oauth2Auth) Verify(c *http.Client, rs *http.Response, path string) (redo bool, err error) {
+    if rs.StatusCode == http.StatusUnauthorized {
+        // 令牌可能已被提前吊销，丢弃后由下一次请求重新获取；上传的数据流无法重放，因此不在此重试
+        o.mu.Lock()
+        o.accessToken = ""
+        o.mu.Unlock()
+        err = gowebdav.NewPathError("Authorize", path, rs.StatusCode)
+    }
+    return
+}
+
+func (o *oauth2Auth) Close() error {
+    return nil
+}
+
+func (o *oauth2Auth) Clone() gowebdav.Authenticator {
+    return o
+}
+
+func (o *oauth2Auth) String() string {
+    return "OAuth2Auth"
+}
+
+// refresh 使用刷新令牌向令牌端点换取新的访问令牌，调用方需持有 mu
+func (o *oauth2Auth) refresh(c *http.Client) error {
+    form := url.Values{
+        "grant_type":    {"refresh_token"},
+        "refresh_token": {o.refreshToken},
+        "client_id":     {o.clientID},
+    }
+    if o.clientSecret != "" {
+        form.Set("client_secret", o.clientSecret)
+    }
+    rs, err := c.Post(o.tokenURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+    if err != nil {
+        return err
+    }
+    defer rs.Body.Close()
+    if rs.StatusCode >= 400 && rs.StatusCode < 500 {
+        // 刷新令牌已失效或被吊销，需要重新授权
+        return fmt.Errorf("刷新 OAuth2 令牌失败: %w: %s", errAuthRejected, rs.Status)
+    }
+    if rs.StatusCode != http.StatusOK {
+        return fmt.Errorf("刷新 OAuth2 令牌失败: %s", rs.Status)
+    }
+    var token oauth2Token
+    if err := json.NewDecoder(rs.Body).Decode(&token); err != nil {
+        return err
+    }
+    if token.AccessToken == "" {
+        return fmt.Errorf("刷新 OAuth2 令牌失败: 响应中没有 access_token")
+    }
+    o.accessToken = token.AccessToken
+    o.expiry = time.Time{}
+    if token.ExpiresIn > 0 {
+        o.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+    }
+    // 部分服务器每次刷新都会轮换刷新令牌，旧令牌随即失效，必须保存新令牌
+    if token.RefreshToken != "" && token.RefreshToken != o.refreshToken {
+        o.refreshToken = token.RefreshToken
+        if o.onRefresh != nil {
+            o.onRefresh(token.RefreshToken)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+)
+
+const (
+    breakerThreshold   = 5                // 连续多少次服务器错误后熔断
+    breakerCooldown    = 30 * time.Second // 熔断后首次探测前的等待时间
+    breakerMaxCooldown = 5 * time.Minute  // 探测连续失败时等待时间的上限
+    maxRetryAfter      = time.Hour        // Retry-After 的上限，防止异常值长期阻塞同步
+)
+
+// errCircuitOpen 表示服务器要求限流或已熔断，请求未发出
+var errCircuitOpen = errors.New("服务器繁忙，暂停请求")
+
+// breaker 包装账户的传输层，由使用该账户的所有同步对共享。
+// 服务器返回 429/503 时遵守 Retry-After，连续出现 5xx 时熔断；
+// 等待结束后进入半开状态，只放行一个探测请求，成功后才恢复正常流量。
+type breaker struct {
+    next http.RoundTripper
+
+    mu        sync.Mutex
+    failures  int           // 连续服务器错误次数
+    openUntil time.Time     // 在此之前拒绝所有请求；已过期但非零表示半开
+    cooldown  time.Duration // 下一次熔断的等待时间
+    probing   bool          // 半开状态下是否已有探测请求在途
+}
+
+func newBreaker(next http.RoundTripper) *breaker {
+    return &breaker{next: next, cooldown: breakerCooldown}
+}
+
+func (b *breaker) RoundTrip(rq *http.Request) (*http.Response, error) {
+    probe, err := b.allow()
+    if err != nil {
+        if rq.Body != nil {
+            rq.Body.Close()
+        }
+        return nil, err
+    }
+    rs, err := b.next.RoundTrip(rq)
+    b.record(probe, rs, err)
+    return rs, err
+}
+
+// allow 判断请求能否发出，半开状态下返回 probe 表示该请求是探测请求
+func (b *breaker) allow() (probe bool, err error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.openUntil.IsZero() {
+        return false, nil
+    }
+    if wait := time.Until(b.openUntil); wait > 0 {
+        return false, fmt.Errorf("%w，%s 后重试", errCircuitOpen, wait.Round(time.Second))
+    }
+    if b.probing {
+        return false, fmt.Errorf("%w，等待探测结果", errCircuitOpen)
+    }
+    b.probing = true
+    return true, nil
+}
+
+// record 根据响应更新熔断状态
+func (b *breaker) record(probe bool, rs *http.Response, err error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if probe {
+        b.probing = false
+    }
+    if err != nil {
+        // 网络错误由连接状态检查处理，但探测失败时需要继续等待
+        if probe {
+            b.open()
+        }
+        return
+    }
+
+    throttled := rs.StatusCode == http.StatusTooManyRequests || rs.StatusCode == http.StatusServiceUnavailable
+    if !throttled && rs.StatusCode < 500 {
+        b.failures = 0
+        b.openUntil = time.Time{}
+        b.cooldown = breakerCooldown
+        return
+    }
+
+    b.failures++
+    if wait, ok := retryAfter(rs); ok && throttled {
+        b.openUntil = time.Now().Add(wait)
+        return
+    }
+    if probe || b.failures >= breakerThreshold {
+        b.open()
+    }
+}
+
+// open 熔断，探测再次失败时等待时间加倍
+func (b *breaker) open() {
+    if !b.openUntil.IsZero() {
+        b.cooldown = min(b.cooldown*2, breakerMaxCooldown)
+    }
+    b.openUntil = time.Now().Add(b.cooldown)
+}
+
+// retryAfter 解析 Retry-After 响应头，支持秒数和 HTTP 日期两种格式
+func retryAfter(rs *http.Response) (time.Duration, bool) {
+    value := rs.Header.Get("Retry-After")
+    if value == "" {
+        return 0, false
+    }
+    var wait time.Duration
+    if seconds, err := strconv.Atoi(value); err == nil {
+        wait = time.Duration(seconds) * time.Second
+    } else if at, err := http.ParseTime(value); err == nil {
+        wait = time.Until(at)
+    } else {
+        return 0, false
+    }
+    return max(0, min(wait, maxRetryAfter)), true
+}
@@ -0,0 +1,237 @@
+package engine
+
+import (
+    "bytes"
+    "database/sql"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/studio-b12/gowebdav"
+    "github.com/zeebo/blake3"
+)
+
+const (
+    deltaBlockSize = 1 << 20  // 块签名的块大小
+    deltaMinSize   = 8 << 20  // 小于此大小的文件直接完整上传，不保存块签名
+    deltaMaxPatch  = 16 << 20 // 单个 PATCH 请求携带的最大数据量
+)
+
+// errDeltaUnsupported 表示服务器不支持 Sabre 部分更新
+var errDeltaUnsupported = errors.New("服务器不支持部分更新")
+
+// blockSignature 是上次上传后云端文件内容的块签名
+type blockSignature struct {
+    size      int64
+    remoteTag string // 上传完成后云端文件的 ETag，不一致说明云端已被其他客户端修改
+    sums      []byte // 每块 32 字节的 BLAKE3 摘要
+}
+
+// blockSigner 在读取数据的同时按块计算签名，用于完整上传时顺便生成签名
+type blockSigner struct {
+    r     io.Reader
+    block *blake3.Hasher
+    n     int
+    size  int64 // 已读取的总字节数
+    sums  []byte
+}
+
+func newBlockSigner(r io.Reader) *blockSigner {
+    return &blockSigner{r: r, block: blake3.New()}
+}
+
+func (s *blockSigner) Read(p []byte) (int, error) {
+    n, err := s.r.Read(p)
+    s.size += int64(n)
+    s.write(p[:n])
+    return n, err
+}
+
+func (s *blockSigner) write(p []byte) {
+    for len(p) > 0 {
+        k := min(len(p), deltaBlockSize-s.n)
+        s.block.Write(p[:k])
+        s.n += k
+        p = p[k:]
+        if s.n == deltaBlockSize {
+            s.flush()
+        }
+    }
+}
+
+func (s *blockSigner) flush() {
+    s.sums = s.block.Sum(s.sums)
+    s.block.Reset()
+    s.n = 0
+}
+
+// Sums 返回全部块的签名，最后不足一块的数据单独成块
+func (s *blockSigner) Sums() []byte {
+    if s.n > 0 {
+        s.flush()
+    }
+    return s.sums
+}
+
+// supportsPatch 通过 OPTIONS 检查服务器是否支持 Sabre 部分更新（PATCH + X-Update-Range），结果会被缓存
+func (se *SyncEngine) supportsPatch() bool {
+    if se.patchChecked {
+        return se.patchSupported
+    }
+    rs, err := se.conn.Do(http.MethodOptions, se.remoteDir, nil, nil)
+    if err != nil {
+        return false
+    }
+    rs.Body.Close()
+    se.patchChecked = true
+    se.patchSupported = strings.Contains(rs.Header.Get("Accept-Patch"), "application/x-sabredav-partialupdate") ||
+        strings.Contains(strings.Join(rs.Header.Values("DAV"), ","), "sabredav-partialupdate")
+    if !se.patchSupported {
+        se.logger.Info().Msg("服务器不支持部分更新，大文件将完整上传")
+    }
+    return se.patchSupported
+}
+
+// uploadDelta 与上次上传的块签名比较，只用 PATCH 上传变化的块。
+// 没有可用签名、云端已被修改、文件变小或服务器不支持时返回 false，由调用方完整上传
+func (se *SyncEngine) uploadDelta(relPath string, f *os.File, progress *transfer) (bool, error) {
+    info, err := f.Stat()
+    if err != nil || info.Size() < deltaMinSize {
+        return false, nil
+    }
+    sig, err := se.loadSignature(relPath)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("读取块签名失败")
+        return false, nil
+    }
+    // PATCH 无法截断文件，变小时只能完整上传
+    if sig == nil || info.Size() < sig.size || !se.supportsPatch() {
+        return false, nil
+    }
+    remotePath := filepath.Join(se.remoteDir, relPath)
+    remote, err := se.client.Stat(remotePath)
+    if err != nil || remote.Size() != sig.size || collectionTag(remote) != sig.remoteTag {
+        return false, nil
+    }
+
+    sums := make([]byte, 0, len(sig.sums))
+    buf := make([]byte, deltaBlockSize)
+    var pending []byte
+    var pendingOffset, sent int64
+    patched := false
+    flush := func() error {
+        if len(pending) == 0 {
+            return nil
+        }
+        if err := se.patch(remotePath, pendingOffset, pending); err != nil {
+            return err
+        }
+        patched = true
+        sent += int64(len(pending))
+        pending = pending[:0]
+        return nil
+    }
+    for i, offset := 0, int64(0); offset < info.Size(); i, offset = i+1, offset+deltaBlockSize {
+        n, err := io.ReadFull(f, buf)
+        if err != nil && err != io.ErrUnexpectedEOF {
+            return false, err
+        }
+        progress.add(int64(n))
+        sum := blake3.Sum256(buf[:n])
+        sums = append(sums, sum[:]...)
+        if (i+1)*32 <= len(sig.sums) && bytes.Equal(sum[:], sig.sums[i*32:(i+1)*32]) {
+            if err := flush(); err != nil {
+                return se.deltaFailed(relPath, patched, err)
+            }
+            continue
+        }
+        if len(pending) == 0 {
+            pendingOffset = offset
+        }
+        pending = append(pending, buf[:n]...)
+        if len(pending) >= deltaMaxPatch {
+            if err := flush(); err != nil {
+                return se.deltaFailed(relPath, patched, err)
+            }
+        }
+    }
+    if err := flush(); err != nil {
+        return se.deltaFailed(relPath, patched, err)
+    }
+    se.logger.Info().Msgf("增量上传 %s：上传 %d / %d 字节", relPath, sent, info.Size())
+    se.saveSignature(relPath, info.Size(), sums)
+    return true, nil
+}
+
+// deltaFailed 处理 PATCH 失败。尚未写入任何数据时可以安全地回退到完整上传；
+// 已部分写入时云端内容不再与签名一致，丢弃签名，重试时完整上传
+func (se *SyncEngine) deltaFailed(relPath string, patched bool, err error) (bool, error) {
+    if !patched && errors.Is(err, errDeltaUnsupported) {
+        se.patchSupported = false
+        se.logger.Info().Err(err).Msg("部分更新被拒绝，改为完整上传")
+        return false, nil
+    }
+    se.forgetSignature(relPath)
+    return false, err
+}
+
+// patch 使用 Sabre 部分更新写入云端文件的一段数据
+func (se *SyncEngine) patch(remotePath string, offset int64, data []byte) error {
+    header := http.Header{
+        "Content-Type":   {"application/x-sabredav-partialupdate"},
+        "X-Update-Range": {fmt.Sprintf("bytes=%d-%d", offset, offset+int64(len(data))-1)},
+    }
+    if err := uploadLimiter.wait(se.ctx, len(data)); err != nil {
+        return err
+    }
+    rs, err := se.conn.Do(http.MethodPatch, remotePath, data, header)
+    if err != nil {
+        return err
+    }
+    rs.Body.Close()
+    switch rs.StatusCode {
+    case http.StatusOK, http.StatusNoContent:
+        return nil
+    case http.StatusMethodNotAllowed, http.StatusUnsupportedMediaType, http.StatusNotImplemented:
+        return errDeltaUnsupported
+    }
+    return gowebdav.NewPathError("PATCH", remotePath, rs.StatusCode)
+}
+
+func (se *SyncEngine) loadSignature(relPath string) (*blockSignature, error) {
+    var sig blockSignature
+    var blockSize int64
+    err := se.db.QueryRow("SELECT size, block_size, remote_tag, blocks FROM block_signatures WHERE profile_id = ? AND path = ?",
+        se.profileID, relPath).Scan(&sig.size, &blockSize, &sig.remoteTag, &sig.sums)
+    if err == sql.ErrNoRows || (err == nil && blockSize != deltaBlockSize) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &sig, nil
+}
+
+// saveSignature 在上传完成后保存块签名和云端文件当前的 ETag
+func (se *SyncEngine) saveSignature(relPath string, size int64, sums []byte) {
+    remote, err := se.client.Stat(filepath.Join(se.remoteDir, relPath))
+    if err != nil {
+        se.forgetSignature(relPath)
+        return
+    }
+    _, err = se.db.Exec("INSERT OR REPLACE INTO block_signatures (profile_id, path, size, block_size, remote_tag, blocks) VALUES (?, ?, ?, ?, ?, ?)",
+        se.profileID, relPath, size, deltaBlockSize, collectionTag(remote), sums)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("保存块签名失败")
+    }
+}
+
+func (se *SyncEngine) forgetSignature(relPath string) {
+    if _, err := se.db.Exec("DELETE FROM block_signatures WHERE profile_id = ? AND path = ?", se.profileID, relPath); err != nil {
+        se.logger.Error().Err(err).Msg("删除块签名失败")
+    }
+}
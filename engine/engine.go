@@ -2,13 +2,15 @@ package engine
 
 import (
     "context"
-    "crypto/sha1"
     "database/sql"
+    "errors"
     "fmt"
     "io"
-    "net/http"
     "os"
     "path/filepath"
+    "strings"
+    "sync"
+    "sync/atomic"
     "time"
 
     "github.com/fsnotify/fsnotify"
@@ -18,7 +20,11 @@ import (
 )
 
 type SyncEngine struct {
+    profileID        int64
+    ctx              context.Context
+    cancel           context.CancelFunc
     client           *gowebdav.Client
+    conn             *Connection
     localDir         string
     remoteDir        string
     mode             string
@@ -26,16 +32,42 @@ type SyncEngine struct {
     taskQueue        chan models.Task
     logger           zerolog.Logger
     db               *sql.DB
-    networkAvailable bool
+    healthMu         sync.Mutex
+    health           HealthState
+    healthErr        error
     config           models.Config
     paused           bool
+    held             bool // 批量删除等待确认或已被取消，由删除保护暂停同步，与手动和计划暂停分开
+    queueMu          sync.Mutex
+    queued           map[taskKey]bool // 已在任务队列中的任务，避免重复入队
+    deleteConfirms   chan models.DeleteConfirmation
+    deleteMu         sync.Mutex
+    heldDeletes      []models.Task
+    rootMu           sync.Mutex
+    rootErr          error
+    ignores          ignoreMatcher
+    localActivity    chan struct{}
+    remoteActivity   chan struct{} // 推送通道通知云端有变化
+    rescanRequests   chan struct{} // 文件监控丢失事件，需要重新扫描本地目录
+    pushActive       atomic.Bool   // 推送通道已连接，轮询只作为兜底
+    rootTag          string    // 上次完整列出时云端同步目录的 ETag
+    lastFullPoll     time.Time // 上次完整列出云端同步目录的时间
+    syncUnsupported  bool      // 服务器不支持 sync-collection，每次轮询都完整列出
+    patchChecked     bool      // 是否已检查服务器对部分更新的支持
+    patchSupported   bool      // 服务器支持 Sabre 部分更新，大文件可以增量上传
+    progress         progressHub // 传输进度的订阅者
 }
 
-func NewSyncEngine(cfg models.Config, db *sql.DB) *SyncEngine {
-    client := gowebdav.NewClient(cfg.URL, cfg.User, cfg.Pass)
-    logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+// NewSyncEngine 创建同步对的引擎，conn 由使用同一账户的同步对共用
+func NewSyncEngine(profileID int64, cfg models.Config, db *sql.DB, conn *Connection) *SyncEngine {
+    logger := zerolog.New(os.Stdout).With().Timestamp().Int64("profile", profileID).Logger()
+    ctx, cancel := context.WithCancel(context.Background())
     engine := &SyncEngine{
-        client:           client,
+        profileID:        profileID,
+        ctx:              ctx,
+        cancel:           cancel,
+        client:           conn.Client,
+        conn:             conn,
         localDir:         cfg.LocalDir,
         remoteDir:        cfg.RemoteDir,
         mode:             cfg.Mode,
@@ -43,12 +75,21 @@ func NewSyncEngine(cfg models.Config, db *sql.DB) *SyncEngine {
         taskQueue:        make(chan models.Task, 100),
         logger:           logger,
         db:               db,
-        networkAvailable: true,
+        health:           HealthOnline,
         config:           cfg,
         paused:           false,
+        deleteConfirms:   make(chan models.DeleteConfirmation),
+        localActivity:    make(chan struct{}, 1),
+        remoteActivity:   make(chan struct{}, 1),
+        rescanRequests:   make(chan struct{}, 1),
+        queued:           make(map[taskKey]bool),
     }
+    engine.loadHeldDeletes()
     go engine.monitorNetwork()
     go engine.retryTasks()
+    go engine.purgeTrash()
+    go engine.pruneVersions()
+    go engine.guardDeletes()
     return engine
 }
 
@@ -56,6 +97,16 @@ func (se *SyncEngine) Conflicts() <-chan models.Conflict {
     return se.conflicts
 }
 
+func (se *SyncEngine) ProfileID() int64 {
+    return se.profileID
+}
+
+// Stop 停止引擎的所有后台任务，用于删除或重建同步对
+func (se *SyncEngine) Stop() {
+    se.cancel()
+    se.logger.Info().Msg("同步引擎已停止")
+}
+
 func (se *SyncEngine) Pause() {
     se.paused = true
     se.logger.Info().Msg("同步已暂停")
@@ -71,34 +122,71 @@ func (se *SyncEngine) IsPaused() bool {
     return se.paused
 }
 
+// Held 判断同步是否因批量删除等待确认而暂停
+func (se *SyncEngine) Held() bool {
+    return se.held
+}
+
+// hold 在批量删除等待确认时暂停同步，不影响手动和计划暂停的状态
+func (se *SyncEngine) hold() {
+    se.held = true
+    se.logger.Info().Msg("同步已暂停，等待确认批量删除")
+}
+
+// unhold 解除删除保护的暂停，手动或计划暂停仍然有效
+func (se *SyncEngine) unhold() {
+    if !se.held {
+        return
+    }
+    se.held = false
+    se.logger.Info().Msg("删除保护已解除")
+    se.resumeTasks()
+}
+
+// suspended 判断同步是否因任何原因暂停
+func (se *SyncEngine) suspended() bool {
+    return se.paused || se.held
+}
+
 func (se *SyncEngine) UpdateConfig(cfg models.Config) {
+    if cfg.URL != se.config.URL || cfg.LocalDir != se.localDir || cfg.RemoteDir != se.remoteDir {
+        se.resetRoot()
+    }
+    filtersChanged := models.FormatFilterRules(cfg.Filters) != models.FormatFilterRules(se.config.Filters)
     se.config = cfg
-    se.client = gowebdav.NewClient(cfg.URL, cfg.User, cfg.Pass)
     se.localDir = cfg.LocalDir
     se.remoteDir = cfg.RemoteDir
     se.mode = cfg.Mode
+    if filtersChanged {
+        se.recheckFilters()
+    }
     se.logger.Info().Msg("同步配置已更新")
 }
 
-func (se *SyncEngine) monitorNetwork() {
-    ticker := time.NewTicker(10 * time.Second)
-    defer ticker.Stop()
-    for range ticker.C {
-        wasAvailable := se.networkAvailable
-        se.networkAvailable = se.checkNetwork()
-        if !wasAvailable && se.networkAvailable {
-            se.logger.Info().Msg("网络恢复，同步已恢复")
-            se.resumeTasks()
-        } else if wasAvailable && !se.networkAvailable {
-            se.logger.Info().Msg("网络断开，正在缓存变更")
-        }
+// setAccount 切换到账户的共享连接，并应用账户的最新凭据
+func (se *SyncEngine) setAccount(account models.Account, conn *Connection) {
+    if account.URL != se.config.URL {
+        se.resetRoot()
     }
+    se.config.AccountID = account.ID
+    se.config.URL, se.config.User, se.config.Pass = account.URL, account.User, account.Pass
+    se.client = conn.Client
+    se.conn = conn
+    se.logger.Info().Msgf("已应用账户 %s 的凭据", account.Name)
 }
 
-func (se *SyncEngine) checkNetwork() bool {
-    client := &http.Client{Timeout: 3 * time.Second}
-    _, err := client.Get(se.config.URL)
-    return err == nil
+// resetRoot 在同步对指向的位置变更后清除根标识，下个周期重新建立
+func (se *SyncEngine) resetRoot() {
+    if err := se.saveRootID(""); err != nil {
+        se.logger.Error().Err(err).Msg("重置同步根标识失败")
+    }
+    if err := se.saveSyncToken(""); err != nil {
+        se.logger.Error().Err(err).Msg("重置同步令牌失败")
+    }
+    se.setRootError(nil)
+    se.rootTag = ""
+    se.syncUnsupported = false
+    se.patchChecked = false
 }
 
 func (se *SyncEngine) Start(ctx context.Context) error {
@@ -107,7 +195,12 @@ func (se *SyncEngine) Start(ctx context.Context) error {
         se.logger.Error().Err(err).Msg("启动文件监控失败")
         return err
     }
-    defer watcher.Close()
+    ctx, cancel := context.WithCancel(ctx)
+    context.AfterFunc(se.ctx, cancel)
+    go func() {
+        <-ctx.Done()
+        watcher.Close()
+    }()
 
     go func() {
         for {
@@ -116,7 +209,7 @@ func (se *SyncEngine) Start(ctx context.Context) error {
                 if !ok {
                     return
                 }
-                if se.paused {
+                if se.suspended() {
                     continue
                 }
                 se.handleLocalChange(event)
@@ -125,6 +218,10 @@ func (se *SyncEngine) Start(ctx context.Context) error {
                     return
                 }
                 se.logger.Error().Err(err).Msg("文件监控错误")
+                if errors.Is(err, fsnotify.ErrEventOverflow) {
+                    // 事件队列溢出时丢失的变更只能通过重新扫描发现
+                    se.requestRescan()
+                }
             }
         }
     }()
@@ -132,27 +229,60 @@ func (se *SyncEngine) Start(ctx context.Context) error {
     err = watcher.Add(se.localDir)
     if err != nil {
         se.logger.Error().Err(err).Msg("添加监控目录失败")
+        cancel()
         return err
     }
 
     go se.pollRemote(ctx)
+    go se.listenPush(ctx)
+    go se.rescanLocal(ctx)
     return nil
 }
 
+// isInternalPath 判断相对路径是否属于引擎内部使用的文件，这类路径不参与同步
+func isInternalPath(relPath string) bool {
+    first := strings.SplitN(filepath.ToSlash(relPath), "/", 2)[0]
+    return first == TrashDirName || first == VersionsDirName || first == MarkerFileName
+}
+
+// outOfScope 判断路径是否不在同步范围内：内部文件、被忽略或在选择性同步中未勾选
+func (se *SyncEngine) outOfScope(relPath string, isDir bool) bool {
+    return isInternalPath(relPath) || se.isIgnored(relPath, isDir) || se.isExcluded(relPath)
+}
+
 func (se *SyncEngine) handleLocalChange(event fsnotify.Event) {
     relPath, _ := filepath.Rel(se.localDir, event.Name)
+    fi, statErr := os.Stat(event.Name)
+    if se.outOfScope(relPath, statErr == nil && fi.IsDir()) {
+        return
+    }
+    if statErr == nil && !fi.IsDir() {
+        if reason := se.filterReason(relPath, fi.Size(), fi.ModTime()); reason != "" {
+            se.markSkipped(relPath, reason)
+            return
+        }
+    }
     file := models.FileInfo{Path: relPath}
+    select {
+    case se.localActivity <- struct{}{}:
+    default:
+    }
 
     if event.Op&fsnotify.Remove == fsnotify.Remove {
+        if err := se.verifyLocalRoot(); err != nil {
+            // 本地根目录不可用时删除事件不可信，不记录为本地删除
+            return
+        }
         file.Status = "local_deleted"
         file.LocalMtime = 0
         file.LocalHash = ""
+        se.forgetHash(file.Path)
         se.logger.Info().Msgf("本地文件 %s 已删除", file.Path)
-        _, err := se.db.Exec("INSERT OR REPLACE INTO files (path, status) VALUES (?, ?)", file.Path, file.Status)
+        _, err := se.db.Exec("INSERT OR REPLACE INTO files (profile_id, path, status) VALUES (?, ?, ?)", se.profileID, file.Path, file.Status)
         if err != nil {
             se.logger.Error().Err(err).Msg("保存文件状态失败")
         }
-        if se.networkAvailable {
+        if se.reachable() {
             se.compareAndSync(file)
         } else {
             se.queueTask(models.Task{Path: file.Path, Operation: "delete_remote", Status: "pending"})
@@ -160,21 +290,18 @@ func (se *SyncEngine) handleLocalChange(event fsnotify.Event) {
         return
     }
 
-    if f, err := os.Open(event.Name); err == nil {
-        h := sha1.New()
-        io.Copy(h, f)
-        file.LocalHash = fmt.Sprintf("%x", h.Sum(nil))
-        fi, _ := f.Stat()
+    if hash, fi, err := se.localHash(relPath); err == nil {
+        file.LocalHash = hash
         file.LocalMtime = fi.ModTime().Unix()
+        file.LocalSize = fi.Size()
         file.Status = "local_modified"
-        f.Close()
         se.logger.Info().Msgf("本地文件 %s 已修改", file.Path)
-        _, err = se.db.Exec("INSERT OR REPLACE INTO files (path, local_hash, local_mtime, status) VALUES (?, ?, ?, ?)",
-            file.Path, file.LocalHash, file.LocalMtime, file.Status)
+        _, err = se.db.Exec("INSERT OR REPLACE INTO files (profile_id, path, local_hash, local_mtime, local_size, status) VALUES (?, ?, ?, ?, ?, ?)",
+            se.profileID, file.Path, file.LocalHash, file.LocalMtime, file.LocalSize, file.Status)
         if err != nil {
             se.logger.Error().Err(err).Msg("保存文件状态失败")
         }
-        if se.networkAvailable {
+        if se.reachable() {
             se.compareAndSync(file)
         } else {
             se.queueTask(models.Task{Path: file.Path, Operation: "upload", Status: "pending"})
@@ -182,66 +309,203 @@ func (se *SyncEngine) handleLocalChange(event fsnotify.Event) {
     }
 }
 
+// fullPollInterval 是即使根目录 ETag 未变也完整列出云端的间隔，
+// 部分服务器的目录 ETag 不会随子项变化而更新
+const fullPollInterval = 10 * time.Minute
+
+// pollInterval 返回配置的基础轮询间隔
+func (se *SyncEngine) pollInterval() time.Duration {
+    return time.Duration(max(se.config.PollInterval, 1)) * time.Second
+}
+
+// maxPollInterval 返回无变化时轮询间隔的上限
+func (se *SyncEngine) maxPollInterval() time.Duration {
+    return max(time.Duration(se.config.MaxPollInterval)*time.Second, se.pollInterval())
+}
+
+// collectionTag 返回目录的 ETag，服务器未提供时使用 getlastmodified
+func collectionTag(fi os.FileInfo) string {
+    if f, ok := fi.(*gowebdav.File); ok && f.ETag() != "" {
+        return f.ETag()
+    }
+    if fi.ModTime().IsZero() {
+        return ""
+    }
+    return fi.ModTime().UTC().Format(time.RFC3339Nano)
+}
+
+// pollRemote 轮询云端变化。没有变化时逐步延长间隔，直到配置的最大间隔；
+// 发现变化或本地有改动时恢复基础间隔。推送通道连接时按最大间隔轮询，收到通知后立即轮询
 func (se *SyncEngine) pollRemote(ctx context.Context) {
-    ticker := time.NewTicker(1 * time.Second)
-    defer ticker.Stop()
+    interval := se.pollInterval()
+    timer := time.NewTimer(interval)
+    defer timer.Stop()
+    deadline := time.Now().Add(interval) // 计时器下次触发的时间
 
     for {
         select {
         case <-ctx.Done():
             return
-        case <-ticker.C:
-            if !se.networkAvailable || se.paused {
+        case <-se.localActivity:
+            if se.pushActive.Load() {
                 continue
             }
-            remoteFiles, err := se.client.ReadDir(se.remoteDir)
-            if err != nil {
-                se.logger.Error().Err(err).Msg("轮询云端失败")
-                se.networkAvailable = false
-                continue
+            // 本地改动后云端往往也会有相关变化（如其他客户端的冲突副本），尽快轮询。
+            // 只提前不推迟，持续的本地写入不会使云端轮询一直被延后
+            interval = se.pollInterval()
+            if next := time.Now().Add(interval); next.Before(deadline) {
+                stopTimer(timer)
+                timer.Reset(interval)
+                deadline = next
             }
-
-            localFiles, err := se.getLocalFilesFromDB()
-            if err != nil {
-                se.logger.Error().Err(err).Msg("获取文件列表失败")
-                continue
+            continue
+        case <-se.remoteActivity:
+            interval = se.pollInterval()
+            stopTimer(timer)
+        case <-timer.C:
+        }
+        if se.reachable() && !se.suspended() {
+            if se.pollOnce() {
+                interval = se.pollInterval()
+            } else {
+                interval = min(interval*2, se.maxPollInterval())
             }
+        }
+        if se.pushActive.Load() {
+            interval = se.maxPollInterval()
+        }
+        timer.Reset(interval)
+        deadline = time.Now().Add(interval)
+    }
+}
 
-            for _, lf := range localFiles {
-                found := false
-                for _, rf := range remoteFiles {
-                    relPath := rf.Name() // 使用 Name() 获取文件名
-                    if lf.Path == relPath {
-                        found = true
-                        lf.RemoteMtime = rf.ModTime().Unix()
-                        if lf.RemoteMtime > lf.LastSync {
-                            lf.Status = "remote_modified"
-                            se.logger.Info().Msgf("云端文件 %s 已修改", lf.Path)
-                            _, err = se.db.Exec("UPDATE files SET remote_mtime = ?, status = ? WHERE path = ?",
-                                lf.RemoteMtime, lf.Status, lf.Path)
-                            if err != nil {
-                                se.logger.Error().Err(err).Msg("更新文件状态失败")
-                            }
-                            se.compareAndSync(lf)
-                        }
-                        break
-                    }
-                }
-                if !found && lf.Status != "remote_deleted" && lf.RemoteMtime > 0 {
-                    lf.RemoteHash = ""
-                    lf.RemoteMtime = 0
-                    lf.Status = "remote_deleted"
-                    se.logger.Info().Msgf("云端文件 %s 已删除", lf.Path)
-                    _, err = se.db.Exec("UPDATE files SET remote_mtime = ?, status = ? WHERE path = ?",
-                        lf.RemoteMtime, lf.Status, lf.Path)
-                    if err != nil {
-                        se.logger.Error().Err(err).Msg("更新文件状态失败")
-                    }
-                    se.compareAndSync(lf)
-                }
+// stopTimer 停止计时器并清空未读取的触发，之后可以安全地 Reset
+func stopTimer(timer *time.Timer) {
+    if !timer.Stop() {
+        select {
+        case <-timer.C:
+        default:
+        }
+    }
+}
+
+// pollOnce 获取云端同步目录的变化并与本地记录比较，返回是否发现云端变化。
+// 服务器支持 sync-collection 时只获取增量，否则完整列出同步目录
+func (se *SyncEngine) pollOnce() bool {
+    if err := se.verifyRoots(); err != nil {
+        if !errors.Is(err, errRootMismatch) {
+            se.logger.Error().Err(err).Msg("检查同步根目录失败")
+            se.setHealth(classifyError(err), err)
+        }
+        return false
+    }
+    if changed, ok := se.pollChanges(); ok {
+        return changed
+    }
+
+    // 先只查询根目录的 ETag，未变化时跳过完整列表
+    root, err := se.client.Stat(se.remoteDir)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("轮询云端失败")
+        se.setHealth(classifyError(err), err)
+        return false
+    }
+    tag := collectionTag(root)
+    if tag != "" && tag == se.rootTag && time.Since(se.lastFullPoll) < fullPollInterval {
+        return false
+    }
+    remoteFiles, err := se.client.ReadDir(se.remoteDir)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("轮询云端失败")
+        se.setHealth(classifyError(err), err)
+        return false
+    }
+    changed, err := se.compareRemote(remoteFiles)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("获取文件列表失败")
+        return false
+    }
+    // 列表处理完成后再记录 ETag，失败时下次仍会完整列出
+    se.rootTag, se.lastFullPoll = tag, time.Now()
+    return changed
+}
+
+// compareRemote 将云端同步目录的完整列表与本地记录比较，列表中没有的文件视为已在云端删除
+func (se *SyncEngine) compareRemote(remoteFiles []os.FileInfo) (changed bool, err error) {
+    localFiles, err := se.getLocalFilesFromDB()
+    if err != nil {
+        return false, err
+    }
+    remoteFiles = se.filterRemoteScope(remoteFiles)
+    for _, lf := range localFiles {
+        if se.outOfScope(lf.Path, false) {
+            continue
+        }
+        found := false
+        for _, rf := range remoteFiles {
+            if lf.Path == rf.Name() {
+                found = true
+                changed = se.applyRemoteFile(lf, rf) || changed
+                break
             }
         }
+        if !found {
+            changed = se.applyRemoteDeletion(lf) || changed
+        }
+    }
+    return changed, nil
+}
+
+// applyRemoteFile 根据云端文件信息更新本地记录，云端较新时同步，返回云端是否有修改
+func (se *SyncEngine) applyRemoteFile(lf models.FileInfo, rf os.FileInfo) bool {
+    if reason := se.filterReason(lf.Path, rf.Size(), rf.ModTime()); reason != "" {
+        if lf.Status != "skipped" {
+            se.markSkipped(lf.Path, reason)
+        }
+        return false
+    }
+    if lf.Status == "skipped" {
+        // 过滤规则放宽后不再跳过，按正常流程比较。本地没有副本时按云端新增处理
+        _, err := os.Stat(filepath.Join(se.localDir, lf.Path))
+        local := err == nil
+        se.clearSkipped(lf.Path, local)
+        lf.Status = ""
+        if !local {
+            lf.LocalMtime, lf.LocalSize, lf.LastSync = 0, 0, 0
+        }
+    }
+    lf.RemoteMtime = rf.ModTime().Unix()
+    if lf.RemoteMtime <= lf.LastSync {
+        return false
+    }
+    lf.Status = "remote_modified"
+    se.logger.Info().Msgf("云端文件 %s 已修改", lf.Path)
+    _, err := se.db.Exec("UPDATE files SET remote_mtime = ?, status = ?, skip_reason = '' WHERE profile_id = ? AND path = ?",
+        lf.RemoteMtime, lf.Status, se.profileID, lf.Path)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("更新文件状态失败")
     }
+    se.compareAndSync(lf)
+    return true
+}
+
+// applyRemoteDeletion 记录云端已删除的文件并同步删除，返回是否为新的删除
+func (se *SyncEngine) applyRemoteDeletion(lf models.FileInfo) bool {
+    if lf.Status == "remote_deleted" || lf.RemoteMtime <= 0 {
+        return false
+    }
+    lf.RemoteHash = ""
+    lf.RemoteMtime = 0
+    lf.Status = "remote_deleted"
+    se.logger.Info().Msgf("云端文件 %s 已删除", lf.Path)
+    se.forgetSignature(lf.Path)
+    _, err := se.db.Exec("UPDATE files SET remote_mtime = ?, status = ? WHERE profile_id = ? AND path = ?",
+        lf.RemoteMtime, lf.Status, se.profileID, lf.Path)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("更新文件状态失败")
+    }
+    se.compareAndSync(lf)
+    return true
 }
 
 func (se *SyncEngine) compareAndSync(file models.FileInfo) {
@@ -256,7 +520,7 @@ func (se *SyncEngine) compareAndSync(file models.FileInfo) {
         (dbFile.Status == "remote_deleted" && dbFile.LocalMtime > lastSync) ||
         (dbFile.Status == "local_modified" && dbFile.RemoteMtime > lastSync) {
         choice := make(chan string)
-        se.conflicts <- models.Conflict{File: dbFile, Choice: choice}
+        se.conflicts <- models.Conflict{ProfileID: se.profileID, File: dbFile, Choice: choice}
         switch <-choice {
         case "local":
             if dbFile.Status == "local_deleted" {
@@ -299,41 +563,92 @@ func (se *SyncEngine) compareAndSync(file models.FileInfo) {
 }
 
 func (se *SyncEngine) queueTask(task models.Task) {
+    if se.outOfScope(task.Path, false) {
+        se.logger.Debug().Msgf("忽略任务：%s %s", task.Operation, task.Path)
+        return
+    }
     task.LastAttempt = time.Now().Unix()
-    _, err := se.db.Exec("INSERT OR REPLACE INTO tasks (path, operation, status, retries, last_attempt, chunk_offset) VALUES (?, ?, ?, ?, ?, ?)",
-        task.Path, task.Operation, task.Status, task.Retries, task.LastAttempt, task.ChunkOffset)
+    if isDeleteOperation(task.Operation) {
+        task.Status = "held"
+    }
+    task.ProfileID = se.profileID
+    res, err := se.db.Exec("INSERT OR REPLACE INTO tasks (profile_id, path, operation, status, retries, last_attempt, chunk_offset) VALUES (?, ?, ?, ?, ?, ?, ?)",
+        task.ProfileID, task.Path, task.Operation, task.Status, task.Retries, task.LastAttempt, task.ChunkOffset)
     if err != nil {
         se.logger.Error().Err(err).Msg("保存任务失败")
+    } else if id, err := res.LastInsertId(); err == nil {
+        task.ID = id
+    }
+    if task.Status == "held" {
+        se.holdDelete(task)
+        se.logger.Info().Msgf("删除任务已暂缓，等待本周期检查：%s %s", task.Operation, task.Path)
+        return
     }
-    se.taskQueue <- task
+    se.enqueue(task)
     se.logger.Info().Msgf("任务已缓存：%s %s", task.Operation, task.Path)
 }
 
+// taskKey 标识一个任务，各处按路径和操作更新 tasks 表中的任务
+type taskKey struct {
+    path      string
+    operation string
+}
+
+// enqueue 在后台把任务放入队列，已在队列中的任务不会重复加入。
+// 执行协程也会调用此函数重新排队，因此不能同步写入它自己消费的队列
+func (se *SyncEngine) enqueue(task models.Task) {
+    key := taskKey{task.Path, task.Operation}
+    se.queueMu.Lock()
+    if se.queued[key] {
+        se.queueMu.Unlock()
+        return
+    }
+    se.queued[key] = true
+    se.queueMu.Unlock()
+    go func() {
+        select {
+        case se.taskQueue <- task:
+        case <-se.ctx.Done():
+        }
+    }()
+}
+
 func (se *SyncEngine) retryTasks() {
-    for task := range se.taskQueue {
-        if !se.networkAvailable || task.Retries >= 5 || se.paused {
+    for {
+        var task models.Task
+        select {
+        case <-se.ctx.Done():
+            return
+        case task = <-se.taskQueue:
+        }
+        se.queueMu.Lock()
+        delete(se.queued, taskKey{task.Path, task.Operation})
+        se.queueMu.Unlock()
+        if !se.reachable() || task.Retries >= 5 || se.suspended() {
             time.Sleep(time.Second << uint(task.Retries))
             task.Retries++
-            _, err := se.db.Exec("UPDATE tasks SET retries = ?, last_attempt = ? WHERE path = ? AND operation = ?",
-                task.Retries, time.Now().Unix(), task.Path, task.Operation)
+            _, err := se.db.Exec("UPDATE tasks SET retries = ?, last_attempt = ? WHERE profile_id = ? AND path = ? AND operation = ?",
+                task.Retries, time.Now().Unix(), se.profileID, task.Path, task.Operation)
             if err != nil {
                 se.logger.Error().Err(err).Msg("更新任务失败")
             }
-            se.taskQueue <- task
+            se.enqueue(task)
             continue
         }
         if err := se.executeTask(task); err != nil {
             se.logger.Error().Err(err).Msgf("任务失败：%s %s", task.Operation, task.Path)
+            se.reportError(err)
             task.Retries++
-            _, err = se.db.Exec("UPDATE tasks SET retries = ?, last_attempt = ?, status = 'failed' WHERE path = ? AND operation = ?",
-                task.Retries, time.Now().Unix(), task.Path, task.Operation)
+            _, err = se.db.Exec("UPDATE tasks SET retries = ?, last_attempt = ?, status = 'failed' WHERE profile_id = ? AND path = ? AND operation = ?",
+                task.Retries, time.Now().Unix(), se.profileID, task.Path, task.Operation)
             if err != nil {
                 se.logger.Error().Err(err).Msg("更新任务失败")
             }
-            se.taskQueue <- task
+            se.enqueue(task)
         } else {
-            _, err = se.db.Exec("UPDATE tasks SET status = 'completed', last_attempt = ? WHERE path = ? AND operation = ?",
-                time.Now().Unix(), task.Path, task.Operation)
+            se.reportSuccess()
+            _, err = se.db.Exec("UPDATE tasks SET status = 'completed', last_attempt = ? WHERE profile_id = ? AND path = ? AND operation = ?",
+                time.Now().Unix(), se.profileID, task.Path, task.Operation)
             if err != nil {
                 se.logger.Error().Err(err).Msg("更新任务失败")
             }
@@ -343,6 +658,11 @@ func (se *SyncEngine) retryTasks() {
 }
 
 func (se *SyncEngine) executeTask(task models.Task) error {
+    if isDeleteOperation(task.Operation) {
+        if err := se.RootError(); err != nil {
+            return err
+        }
+    }
     file, err := se.getFileFromDB(task.Path)
     if err != nil {
         return err
@@ -351,7 +671,7 @@ func (se *SyncEngine) executeTask(task models.Task) error {
     case "upload":
         return se.uploadWithResume(file, task)
     case "download":
-        return se.download(file)
+        return se.download(file, task)
     case "delete_remote":
         return se.deleteRemote(file)
     case "delete_local":
@@ -367,7 +687,7 @@ func (se *SyncEngine) resumeTasks() {
         return
     }
     for _, task := range tasks {
-        se.taskQueue <- task
+        se.enqueue(task)
         se.logger.Info().Msgf("恢复任务：%s %s", task.Operation, task.Path)
     }
 }
@@ -380,24 +700,69 @@ func (se *SyncEngine) uploadWithResume(file models.FileInfo, task models.Task) e
         return err
     }
     defer f.Close()
-    f.Seek(task.ChunkOffset, 0)
-    err = se.client.WriteStream(remotePath, f, 0644)
-    if err != nil {
+    total := int64(-1)
+    if info, err := f.Stat(); err == nil {
+        total = info.Size()
+    }
+    progress := se.newTransfer(task.ID, file.Path, "upload", task.ChunkOffset, total)
+    if err := se.upload(file.Path, remotePath, f, task.ChunkOffset, progress); err != nil {
+        progress.finish(err)
         return err
     }
+    progress.finish(nil)
     file.Status = "synced"
     file.LastSync = time.Now().Unix()
-    _, err = se.db.Exec("UPDATE files SET status = ?, last_sync = ? WHERE path = ?",
-        file.Status, file.LastSync, file.Path)
+    _, err = se.db.Exec("UPDATE files SET status = ?, last_sync = ? WHERE profile_id = ? AND path = ?",
+        file.Status, file.LastSync, se.profileID, file.Path)
     if err != nil {
         se.logger.Error().Err(err).Msg("更新文件状态失败")
     }
     return nil
 }
 
-func (se *SyncEngine) download(file models.FileInfo) error {
+// upload 从头上传时先尝试增量上传，否则从 offset 处完整上传
+func (se *SyncEngine) upload(relPath, remotePath string, f *os.File, offset int64, progress *transfer) error {
+    if offset == 0 {
+        if _, err := se.archiveRemote(relPath, true); err != nil {
+            return err
+        }
+        delta, err := se.uploadDelta(relPath, f, progress)
+        if err != nil || delta {
+            return err
+        }
+        // 增量上传的比较可能已读取了部分文件，重新从头计算进度
+        progress.restart()
+    }
+    return se.uploadFull(relPath, remotePath, f, offset, progress)
+}
+
+// uploadFull 完整上传文件。大文件在上传的同时计算块签名，供下次增量上传使用
+func (se *SyncEngine) uploadFull(relPath, remotePath string, f *os.File, offset int64, progress *transfer) error {
+    if _, err := f.Seek(offset, io.SeekStart); err != nil {
+        return err
+    }
+    var body io.Reader = &progressReader{r: &limitedReader{ctx: se.ctx, r: f, limiter: uploadLimiter}, t: progress}
+    var signer *blockSigner
+    if info, err := f.Stat(); err == nil && offset == 0 && info.Size() >= deltaMinSize {
+        signer = newBlockSigner(body)
+        body = signer
+    }
+    if err := se.client.WriteStream(remotePath, body, 0644); err != nil {
+        return err
+    }
+    if signer != nil {
+        se.saveSignature(relPath, signer.size, signer.Sums())
+    }
+    return nil
+}
+
+func (se *SyncEngine) download(file models.FileInfo, task models.Task) error {
     localPath := filepath.Join(se.localDir, file.Path)
     remotePath := filepath.Join(se.remoteDir, file.Path)
+    total := int64(-1)
+    if info, err := se.client.Stat(remotePath); err == nil {
+        total = info.Size()
+    }
     data, err := se.client.ReadStream(remotePath)
     if err != nil {
         return err
@@ -408,11 +773,16 @@ func (se *SyncEngine) download(file models.FileInfo) error {
         return err
     }
     defer f.Close()
-    io.Copy(f, data)
+    progress := se.newTransfer(task.ID, file.Path, "download", 0, total)
+    _, err = io.Copy(f, &progressReader{r: &limitedReader{ctx: se.ctx, r: data, limiter: downloadLimiter}, t: progress})
+    progress.finish(err)
+    if err != nil {
+        return err
+    }
     file.Status = "synced"
     file.LastSync = time.Now().Unix()
-    _, err = se.db.Exec("UPDATE files SET status = ?, last_sync = ? WHERE path = ?",
-        file.Status, file.LastSync, file.Path)
+    _, err = se.db.Exec("UPDATE files SET status = ?, last_sync = ? WHERE profile_id = ? AND path = ?",
+        file.Status, file.LastSync, se.profileID, file.Path)
     if err != nil {
         se.logger.Error().Err(err).Msg("更新文件状态失败")
     }
@@ -420,15 +790,21 @@ func (se *SyncEngine) download(file models.FileInfo) error {
 }
 
 func (se *SyncEngine) deleteRemote(file models.FileInfo) error {
-    remotePath := filepath.Join(se.remoteDir, file.Path)
-    err := se.client.Remove(remotePath)
+    moved, err := se.archiveRemote(file.Path, false)
     if err != nil {
         return err
     }
+    if !moved {
+        remotePath := filepath.Join(se.remoteDir, file.Path)
+        if err := se.client.Remove(remotePath); err != nil {
+            return err
+        }
+    }
+    se.forgetSignature(file.Path)
     file.Status = "synced"
     file.LastSync = time.Now().Unix()
-    _, err = se.db.Exec("UPDATE files SET status = ?, last_sync = ? WHERE path = ?",
-        file.Status, file.LastSync, file.Path)
+    _, err = se.db.Exec("UPDATE files SET status = ?, last_sync = ? WHERE profile_id = ? AND path = ?",
+        file.Status, file.LastSync, se.profileID, file.Path)
     if err != nil {
         se.logger.Error().Err(err).Msg("更新文件状态失败")
     }
@@ -436,15 +812,15 @@ func (se *SyncEngine) deleteRemote(file models.FileInfo) error {
 }
 
 func (se *SyncEngine) deleteLocal(file models.FileInfo) error {
-    localPath := filepath.Join(se.localDir, file.Path)
-    err := os.Remove(localPath)
+    err := se.moveToTrash(file.Path)
     if err != nil {
         return err
     }
     file.Status = "synced"
     file.LastSync = time.Now().Unix()
-    _, err = se.db.Exec("UPDATE files SET status = ?, last_sync = ? WHERE path = ?",
-        file.Status, file.LastSync, file.Path)
+    // 清除本地修改时间，重新扫描时不会把已移入回收站的文件当作本地删除
+    _, err = se.db.Exec("UPDATE files SET status = ?, last_sync = ?, local_mtime = 0, local_size = 0 WHERE profile_id = ? AND path = ?",
+        file.Status, file.LastSync, se.profileID, file.Path)
     if err != nil {
         se.logger.Error().Err(err).Msg("更新文件状态失败")
     }
@@ -453,13 +829,15 @@ func (se *SyncEngine) deleteLocal(file models.FileInfo) error {
 
 func (se *SyncEngine) getFileFromDB(path string) (models.FileInfo, error) {
     var file models.FileInfo
-    row := se.db.QueryRow("SELECT path, local_hash, remote_hash, local_mtime, remote_mtime, last_sync, status FROM files WHERE path = ?", path)
-    err := row.Scan(&file.Path, &file.LocalHash, &file.RemoteHash, &file.LocalMtime, &file.RemoteMtime, &file.LastSync, &file.Status)
+    row := se.db.QueryRow(`SELECT path, COALESCE(local_hash, ''), COALESCE(remote_hash, ''), COALESCE(local_mtime, 0), local_size,
+        COALESCE(remote_mtime, 0), COALESCE(last_sync, 0), status FROM files WHERE profile_id = ? AND path = ?`, se.profileID, path)
+    err := row.Scan(&file.Path, &file.LocalHash, &file.RemoteHash, &file.LocalMtime, &file.LocalSize, &file.RemoteMtime, &file.LastSync, &file.Status)
     return file, err
 }
 
 func (se *SyncEngine) getLocalFilesFromDB() ([]models.FileInfo, error) {
-    rows, err := se.db.Query("SELECT path, local_hash, remote_hash, local_mtime, remote_mtime, last_sync, status FROM files")
+    rows, err := se.db.Query(`SELECT path, COALESCE(local_hash, ''), COALESCE(remote_hash, ''), COALESCE(local_mtime, 0), local_size,
+        COALESCE(remote_mtime, 0), COALESCE(last_sync, 0), status FROM files WHERE profile_id = ?`, se.profileID)
     if err != nil {
         return nil, err
     }
@@ -468,7 +846,7 @@ func (se *SyncEngine) getLocalFilesFromDB() ([]models.FileInfo, error) {
     var files []models.FileInfo
     for rows.Next() {
         var file models.FileInfo
-        if err := rows.Scan(&file.Path, &file.LocalHash, &file.RemoteHash, &file.LocalMtime, &file.RemoteMtime, &file.LastSync, &file.Status); err != nil {
+        if err := rows.Scan(&file.Path, &file.LocalHash, &file.RemoteHash, &file.LocalMtime, &file.LocalSize, &file.RemoteMtime, &file.LastSync, &file.Status); err != nil {
             return nil, err
         }
         files = append(files, file)
@@ -477,7 +855,7 @@ func (se *SyncEngine) getLocalFilesFromDB() ([]models.FileInfo, error) {
 }
 
 func (se *SyncEngine) getPendingTasksFromDB() ([]models.Task, error) {
-    rows, err := se.db.Query("SELECT id, path, operation, status, retries, last_attempt, chunk_offset FROM tasks WHERE status = 'pending'")
+    rows, err := se.db.Query("SELECT id, path, operation, status, retries, last_attempt, chunk_offset FROM tasks WHERE profile_id = ? AND status = 'pending'", se.profileID)
     if err != nil {
         return nil, err
     }
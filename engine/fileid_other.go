@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package engine
+
+import "os"
+
+// fileIdentity 在不支持的平台上返回零值，缓存只按大小和修改时间判断
+func fileIdentity(f *os.File, info os.FileInfo) (inode, device int64) {
+    return 0, 0
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package engine
+
+import (
+    "os"
+    "syscall"
+)
+
+// fileIdentity 返回文件的 inode 和设备号，文件被替换（如编辑器保存时重命名）后两者会变化
+func fileIdentity(f *os.File, info os.FileInfo) (inode, device int64) {
+    st, ok := info.Sys().(*syscall.Stat_t)
+    if !ok {
+        return 0, 0
+    }
+    return int64(st.Ino), int64(st.Dev)
+}
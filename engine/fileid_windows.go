@@ -0,0 +1,17 @@
+//go:build windows
+
+package engine
+
+import (
+    "os"
+    "syscall"
+)
+
+// fileIdentity 返回文件索引号和卷序列号，作用与 Unix 的 inode 和设备号相同
+func fileIdentity(f *os.File, info os.FileInfo) (inode, device int64) {
+    var d syscall.ByHandleFileInformation
+    if err := syscall.GetFileInformationByHandle(syscall.Handle(f.Fd()), &d); err != nil {
+        return 0, 0
+    }
+    return int64(d.FileIndexHigh)<<32 | int64(d.FileIndexLow), int64(d.VolumeSerialNumber)
+}
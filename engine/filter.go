@@ -0,0 +1,79 @@
+package engine
+
+import (
+    "fmt"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "WebdavSync/models"
+)
+
+// filterReason 按配置的过滤规则检查文件，返回跳过原因，空字符串表示允许同步
+func (se *SyncEngine) filterReason(relPath string, size int64, mtime time.Time) string {
+    relPath = filepath.ToSlash(relPath)
+    for _, rule := range se.config.Filters {
+        if !ruleApplies(rule, relPath) {
+            continue
+        }
+        if rule.MaxSize > 0 && size > rule.MaxSize {
+            return fmt.Sprintf("文件大小超过 %s", models.FormatSize(rule.MaxSize))
+        }
+        if len(rule.Extensions) > 0 {
+            ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(relPath), "."))
+            allowed := false
+            for _, e := range rule.Extensions {
+                if e == ext {
+                    allowed = true
+                    break
+                }
+            }
+            if !allowed {
+                return fmt.Sprintf("扩展名不在允许列表 %s 中", strings.Join(rule.Extensions, ","))
+            }
+        }
+        if rule.MaxAgeDays > 0 && mtime.Before(time.Now().AddDate(0, 0, -rule.MaxAgeDays)) {
+            return fmt.Sprintf("超过 %d 天未修改", rule.MaxAgeDays)
+        }
+    }
+    return ""
+}
+
+func ruleApplies(rule models.FilterRule, relPath string) bool {
+    return rule.PathPrefix == "" || relPath == rule.PathPrefix || strings.HasPrefix(relPath, rule.PathPrefix+"/")
+}
+
+// clearSkipped 清除不再被过滤规则跳过的文件的跳过状态，之后按正常流程比较本地和云端。
+// 本地没有副本时同时清除本地修改时间和同步时间，云端文件会被重新下载，而不会被当作本地删除
+func (se *SyncEngine) clearSkipped(relPath string, local bool) {
+    se.logger.Info().Msgf("文件 %s 不再被过滤规则跳过", relPath)
+    query := "UPDATE files SET status = '', skip_reason = '' WHERE profile_id = ? AND path = ?"
+    if !local {
+        query = "UPDATE files SET status = '', skip_reason = '', local_mtime = 0, local_size = 0, last_sync = 0 WHERE profile_id = ? AND path = ?"
+    }
+    if _, err := se.db.Exec(query, se.profileID, relPath); err != nil {
+        se.logger.Error().Err(err).Msg("更新文件状态失败")
+    }
+}
+
+// recheckFilters 在过滤规则修改后重新检查所有文件：下次轮询完整列出云端，并重新扫描本地目录，
+// 之前被跳过、现在允许同步的文件会按正常流程同步
+func (se *SyncEngine) recheckFilters() {
+    if err := se.saveSyncToken(""); err != nil {
+        se.logger.Error().Err(err).Msg("重置同步令牌失败")
+    }
+    se.rootTag = ""
+    se.requestRescan()
+    se.notifyRemoteChange()
+}
+
+// markSkipped 记录文件被过滤规则跳过的原因
+func (se *SyncEngine) markSkipped(relPath, reason string) {
+    se.logger.Info().Msgf("文件 %s 已跳过：%s", relPath, reason)
+    _, err := se.db.Exec(`INSERT INTO files (profile_id, path, status, skip_reason) VALUES (?, ?, 'skipped', ?)
+        ON CONFLICT(profile_id, path) DO UPDATE SET status = excluded.status, skip_reason = excluded.skip_reason`,
+        se.profileID, relPath, reason)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("保存文件状态失败")
+    }
+}
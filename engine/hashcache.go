@@ -0,0 +1,100 @@
+package engine
+
+import (
+    "crypto/sha1"
+    "crypto/sha256"
+    "database/sql"
+    "fmt"
+    "hash"
+    "io"
+    "os"
+    "path/filepath"
+    "slices"
+
+    "github.com/cespare/xxhash/v2"
+    "github.com/zeebo/blake3"
+    "WebdavSync/models"
+)
+
+// hashAlgorithm 返回配置的哈希算法，未知的值按 sha1 处理
+func (se *SyncEngine) hashAlgorithm() string {
+    if slices.Contains(models.HashAlgorithms, se.config.HashAlgorithm) {
+        return se.config.HashAlgorithm
+    }
+    return "sha1"
+}
+
+func newHasher(algorithm string) hash.Hash {
+    switch algorithm {
+    case "sha256":
+        return sha256.New()
+    case "blake3":
+        return blake3.New()
+    case "xxhash":
+        return xxhash.New()
+    }
+    return sha1.New()
+}
+
+// formatHash 格式化哈希值。sha1 保持旧版本的纯十六进制格式，其他算法加上前缀，
+// 切换算法后新旧哈希不会被误认为相同
+func formatHash(algorithm string, sum []byte) string {
+    if algorithm == "sha1" {
+        return fmt.Sprintf("%x", sum)
+    }
+    return fmt.Sprintf("%s:%x", algorithm, sum)
+}
+
+// localHash 返回本地文件的哈希及其文件信息。大小、修改时间、inode、设备号和算法
+// 都与缓存一致时直接使用缓存，否则重新计算并更新缓存
+func (se *SyncEngine) localHash(relPath string) (string, os.FileInfo, error) {
+    f, err := os.Open(filepath.Join(se.localDir, relPath))
+    if err != nil {
+        return "", nil, err
+    }
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil {
+        return "", nil, err
+    }
+    if info.IsDir() {
+        return "", nil, fmt.Errorf("%s 是目录", relPath)
+    }
+    inode, device := fileIdentity(f, info)
+    algorithm := se.hashAlgorithm()
+
+    var cached string
+    err = se.db.QueryRow(`SELECT hash FROM hash_cache WHERE profile_id = ? AND path = ?
+        AND size = ? AND mtime = ? AND inode = ? AND device = ? AND algorithm = ?`,
+        se.profileID, relPath, info.Size(), info.ModTime().UnixNano(), inode, device, algorithm).Scan(&cached)
+    if err == nil {
+        return cached, info, nil
+    }
+    if err != sql.ErrNoRows {
+        se.logger.Error().Err(err).Msg("读取哈希缓存失败")
+    }
+
+    h := newHasher(algorithm)
+    if _, err := io.Copy(h, f); err != nil {
+        return "", nil, err
+    }
+    sum := formatHash(algorithm, h.Sum(nil))
+    // 计算期间文件被修改时不写入缓存，下次事件时重新计算
+    if after, err := f.Stat(); err != nil || after.Size() != info.Size() || !after.ModTime().Equal(info.ModTime()) {
+        return sum, info, nil
+    }
+    _, err = se.db.Exec(`INSERT OR REPLACE INTO hash_cache (profile_id, path, size, mtime, inode, device, algorithm, hash)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+        se.profileID, relPath, info.Size(), info.ModTime().UnixNano(), inode, device, algorithm, sum)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("保存哈希缓存失败")
+    }
+    return sum, info, nil
+}
+
+// forgetHash 删除文件的哈希缓存
+func (se *SyncEngine) forgetHash(relPath string) {
+    if _, err := se.db.Exec("DELETE FROM hash_cache WHERE profile_id = ? AND path = ?", se.profileID, relPath); err != nil {
+        se.logger.Error().Err(err).Msg("删除哈希缓存失败")
+    }
+}
@@ -0,0 +1,144 @@
+package engine
+
+import (
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/studio-b12/gowebdav"
+)
+
+// HealthState 表示引擎与 WebDAV 服务器之间的连接状态
+type HealthState string
+
+const (
+    HealthOnline      HealthState = "online"       // 服务器可用，凭据有效
+    HealthOffline     HealthState = "offline"      // 无法连接服务器
+    HealthAuthFailed  HealthState = "auth_failed"  // 凭据无效或已过期
+    HealthServerError HealthState = "server_error" // 服务器内部错误
+    HealthThrottled   HealthState = "throttled"    // 服务器要求限流或已熔断，等待后自动恢复
+    HealthNotFound    HealthState = "not_found"    // 云端同步目录不存在
+    HealthNoSpace     HealthState = "no_space"     // 云端空间不足
+    HealthForbidden   HealthState = "forbidden"    // 没有云端目录的读写权限
+)
+
+// healthCheckInterval 是检查服务器连接状态的间隔
+const healthCheckInterval = 10 * time.Second
+
+// errAuthRejected 表示令牌端点拒绝了刷新请求
+var errAuthRejected = errors.New("认证被拒绝")
+
+// blocking 判断该状态下是否应停止与服务器交互。
+// 空间不足和权限问题只影响部分操作，下载等其余任务仍可继续
+func (s HealthState) blocking() bool {
+    switch s {
+    case HealthOnline, HealthNoSpace, HealthForbidden:
+        return false
+    }
+    return true
+}
+
+// classifyError 根据 WebDAV 请求的错误判断连接状态，无法识别的错误视为离线
+func classifyError(err error) HealthState {
+    if errors.Is(err, errAuthRejected) {
+        return HealthAuthFailed
+    }
+    if errors.Is(err, errCircuitOpen) {
+        return HealthThrottled
+    }
+    var status gowebdav.StatusError
+    if !errors.As(err, &status) {
+        return HealthOffline
+    }
+    switch {
+    case status.Status == http.StatusUnauthorized:
+        return HealthAuthFailed
+    case status.Status == http.StatusForbidden:
+        return HealthForbidden
+    case status.Status == http.StatusNotFound:
+        return HealthNotFound
+    case status.Status == http.StatusInsufficientStorage:
+        return HealthNoSpace
+    case status.Status == http.StatusTooManyRequests || status.Status == http.StatusServiceUnavailable:
+        return HealthThrottled
+    }
+    return HealthServerError
+}
+
+// Health 返回当前连接状态及导致该状态的错误
+func (se *SyncEngine) Health() (HealthState, error) {
+    se.healthMu.Lock()
+    defer se.healthMu.Unlock()
+    return se.health, se.healthErr
+}
+
+// reachable 判断当前是否可以与服务器交互
+func (se *SyncEngine) reachable() bool {
+    state, _ := se.Health()
+    return !state.blocking()
+}
+
+// setHealth 更新连接状态，从不可用恢复时重新执行缓存的任务
+func (se *SyncEngine) setHealth(state HealthState, err error) {
+    se.healthMu.Lock()
+    prev := se.health
+    se.health, se.healthErr = state, err
+    se.healthMu.Unlock()
+    if prev == state {
+        return
+    }
+    switch {
+    case state == HealthOnline:
+        se.logger.Info().Msg("服务器连接正常")
+    case state.blocking():
+        se.logger.Warn().Err(err).Msgf("服务器不可用（%s），正在缓存变更", state)
+    default:
+        se.logger.Warn().Err(err).Msgf("服务器部分操作失败（%s）", state)
+    }
+    if prev.blocking() && !state.blocking() {
+        se.resumeTasks()
+    }
+}
+
+// reportError 记录任务失败时服务器返回的空间不足、权限、认证或限流错误
+func (se *SyncEngine) reportError(err error) {
+    switch state := classifyError(err); state {
+    case HealthAuthFailed, HealthThrottled, HealthNoSpace, HealthForbidden:
+        se.setHealth(state, err)
+    }
+}
+
+// reportSuccess 在任务成功后清除空间不足或权限问题
+func (se *SyncEngine) reportSuccess() {
+    if state, _ := se.Health(); state == HealthNoSpace || state == HealthForbidden {
+        se.setHealth(HealthOnline, nil)
+    }
+}
+
+// monitorNetwork 定期检查服务器连接状态
+func (se *SyncEngine) monitorNetwork() {
+    ticker := time.NewTicker(healthCheckInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-se.ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        err := se.checkHealth()
+        if err == nil {
+            // 根目录可以访问不代表可以写入，空间不足和权限问题由任务成功后清除
+            if state, _ := se.Health(); state.blocking() {
+                se.setHealth(HealthOnline, nil)
+            }
+            continue
+        }
+        se.setHealth(classifyError(err), err)
+    }
+}
+
+// checkHealth 使用账户凭据对云端同步目录发起 PROPFIND，确认服务器可达且凭据有效
+func (se *SyncEngine) checkHealth() error {
+    _, err := se.client.Stat(se.remoteDir)
+    return err
+}
@@ -0,0 +1,204 @@
+package engine
+
+import (
+    "bufio"
+    "io/fs"
+    "os"
+    "path"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "sync"
+    "time"
+)
+
+// IgnoreFileName 是各目录下的忽略规则文件，语法与 .gitignore 相同
+const IgnoreFileName = ".syncignore"
+
+// ignoreRule 是一条编译后的忽略规则
+type ignoreRule struct {
+    re      *regexp.Regexp
+    negate  bool
+    dirOnly bool
+}
+
+// ignoreFile 缓存某个目录下 .syncignore 的规则
+type ignoreFile struct {
+    modTime time.Time
+    rules   []ignoreRule
+}
+
+// ignoreMatcher 合并全局规则和各目录 .syncignore 规则判断路径是否被忽略
+type ignoreMatcher struct {
+    mu        sync.Mutex
+    globalSrc string
+    global    []ignoreRule
+    dirs      map[string]ignoreFile
+}
+
+// parseIgnoreRules 解析 gitignore 语法的规则文本，忽略无法编译的行
+func parseIgnoreRules(text string) []ignoreRule {
+    var rules []ignoreRule
+    scanner := bufio.NewScanner(strings.NewReader(text))
+    for scanner.Scan() {
+        if rule, ok := compileIgnoreRule(scanner.Text()); ok {
+            rules = append(rules, rule)
+        }
+    }
+    return rules
+}
+
+func compileIgnoreRule(line string) (ignoreRule, bool) {
+    var rule ignoreRule
+    line = strings.TrimRight(line, " \t\r")
+    if line == "" || strings.HasPrefix(line, "#") {
+        return rule, false
+    }
+    if strings.HasPrefix(line, "!") {
+        rule.negate = true
+        line = line[1:]
+    } else if strings.HasPrefix(line, `\`) {
+        line = line[1:]
+    }
+    if strings.HasSuffix(line, "/") {
+        rule.dirOnly = true
+        line = strings.TrimRight(line, "/")
+    }
+    anchored := strings.Contains(line, "/")
+    line = strings.TrimPrefix(line, "/")
+    if line == "" {
+        return rule, false
+    }
+
+    var sb strings.Builder
+    sb.WriteString("^")
+    if !anchored {
+        sb.WriteString("(?:.*/)?")
+    }
+    for i := 0; i < len(line); i++ {
+        c := line[i]
+        switch {
+        case strings.HasPrefix(line[i:], "**/"):
+            sb.WriteString("(?:.*/)?")
+            i += 2
+        case strings.HasPrefix(line[i:], "/**") && i+3 == len(line):
+            sb.WriteString("(?:/.*)?")
+            i += 2
+        case strings.HasPrefix(line[i:], "**"):
+            sb.WriteString(".*")
+            i++
+        case c == '*':
+            sb.WriteString("[^/]*")
+        case c == '?':
+            sb.WriteString("[^/]")
+        case c == '[':
+            end := strings.IndexByte(line[i+1:], ']')
+            if end < 0 {
+                sb.WriteString(regexp.QuoteMeta(string(c)))
+                continue
+            }
+            class := line[i+1 : i+1+end]
+            if strings.HasPrefix(class, "!") {
+                class = "^" + class[1:]
+            }
+            sb.WriteString("[" + class + "]")
+            i += end + 1
+        default:
+            sb.WriteString(regexp.QuoteMeta(string(c)))
+        }
+    }
+    sb.WriteString("$")
+    re, err := regexp.Compile(sb.String())
+    if err != nil {
+        return rule, false
+    }
+    rule.re = re
+    return rule, true
+}
+
+// matchIgnoreRules 返回最后一条匹配规则的结果，matched 为 false 表示没有规则匹配
+func matchIgnoreRules(rules []ignoreRule, relPath string, isDir bool) (ignored, matched bool) {
+    for _, rule := range rules {
+        if rule.dirOnly && !isDir {
+            continue
+        }
+        if rule.re.MatchString(relPath) {
+            ignored, matched = !rule.negate, true
+        }
+    }
+    return ignored, matched
+}
+
+// dirRules 读取并缓存 localDir 下 dir 目录的 .syncignore 规则
+func (m *ignoreMatcher) dirRules(localDir, dir string) []ignoreRule {
+    file := filepath.Join(localDir, filepath.FromSlash(dir), IgnoreFileName)
+    fi, err := os.Stat(file)
+    if err != nil {
+        delete(m.dirs, dir)
+        return nil
+    }
+    if cached, ok := m.dirs[dir]; ok && cached.modTime.Equal(fi.ModTime()) {
+        return cached.rules
+    }
+    data, err := os.ReadFile(file)
+    if err != nil {
+        return nil
+    }
+    rules := parseIgnoreRules(string(data))
+    m.dirs[dir] = ignoreFile{modTime: fi.ModTime(), rules: rules}
+    return rules
+}
+
+// ignored 判断相对路径是否被忽略：父目录被忽略时其下所有路径也被忽略
+func (m *ignoreMatcher) ignored(localDir, globalSrc, relPath string, isDir bool) bool {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.dirs == nil || m.globalSrc != globalSrc {
+        m.globalSrc = globalSrc
+        m.global = parseIgnoreRules(globalSrc)
+        m.dirs = make(map[string]ignoreFile)
+    }
+
+    relPath = filepath.ToSlash(relPath)
+    parts := strings.Split(relPath, "/")
+    for i := range parts {
+        current := strings.Join(parts[:i+1], "/")
+        currentIsDir := isDir || i < len(parts)-1
+        ignored, _ := matchIgnoreRules(m.global, current, currentIsDir)
+        // 越深的目录中的 .syncignore 优先级越高
+        for j := 0; j <= i; j++ {
+            dir := strings.Join(parts[:j], "/")
+            rel := strings.TrimPrefix(current, dir+"/")
+            if dir == "" {
+                rel = current
+            }
+            if r, ok := matchIgnoreRules(m.dirRules(localDir, dir), rel, currentIsDir); ok {
+                ignored = r
+            }
+        }
+        if ignored {
+            return true
+        }
+    }
+    return false
+}
+
+// isIgnored 判断路径是否应被排除在同步之外
+func (se *SyncEngine) isIgnored(relPath string, isDir bool) bool {
+    if relPath == "" || relPath == "." {
+        return false
+    }
+    return se.ignores.ignored(se.localDir, se.config.IgnorePatterns, path.Clean(filepath.ToSlash(relPath)), isDir)
+}
+
+// filterRemoteScope 从云端列表中去掉不在同步范围内的条目
+func (se *SyncEngine) filterRemoteScope(entries []fs.FileInfo) []fs.FileInfo {
+    kept := entries[:0]
+    for _, entry := range entries {
+        if se.outOfScope(entry.Name(), entry.IsDir()) {
+            continue
+        }
+        kept = append(kept, entry)
+    }
+    return kept
+}
@@ -0,0 +1,165 @@
+package engine
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+
+    "WebdavSync/models"
+)
+
+// loginFlowPollInterval 是轮询 Nextcloud 登录结果的间隔
+var loginFlowPollInterval = 2 * time.Second
+
+// LoginFlow 表示一次进行中的 Nextcloud Login Flow v2 登录
+type LoginFlow struct {
+    LoginURL string // 需要在浏览器中打开的登录页面
+
+    client   *http.Client
+    endpoint string
+    token    string
+}
+
+// loginFlowResult 是登录完成后轮询接口返回的 JSON
+type loginFlowResult struct {
+    Server      string `json:"server"`
+    LoginName   string `json:"loginName"`
+    AppPassword string `json:"appPassword"`
+}
+
+// StartLoginFlow 向 Nextcloud 服务器发起 Login Flow v2，返回浏览器登录地址和轮询凭据。
+// transport 应使用账户的 TLS 设置，为 nil 时使用默认传输层
+func StartLoginFlow(ctx context.Context, server string, transport http.RoundTripper) (*LoginFlow, error) {
+    client := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+    server = strings.TrimSuffix(server, "/")
+    rq, err := http.NewRequestWithContext(ctx, http.MethodPost, server+"/index.php/login/v2", nil)
+    if err != nil {
+        return nil, err
+    }
+    rq.Header.Set("User-Agent", "WebdavSync")
+    rs, err := client.Do(rq)
+    if err != nil {
+        return nil, err
+    }
+    defer rs.Body.Close()
+    if rs.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("发起 Nextcloud 登录失败: %s", rs.Status)
+    }
+
+    var start struct {
+        Poll struct {
+            Token    string `json:"token"`
+            Endpoint string `json:"endpoint"`
+        } `json:"poll"`
+        Login string `json:"login"`
+    }
+    if err := json.NewDecoder(rs.Body).Decode(&start); err != nil {
+        return nil, err
+    }
+    if start.Login == "" || start.Poll.Endpoint == "" || start.Poll.Token == "" {
+        return nil, fmt.Errorf("发起 Nextcloud 登录失败: 服务器响应不完整")
+    }
+    return &LoginFlow{
+        LoginURL: start.Login,
+        client:   client,
+        endpoint: start.Poll.Endpoint,
+        token:    start.Poll.Token,
+    }, nil
+}
+
+// Wait 轮询直到用户在浏览器中完成授权，返回使用应用密码的 WebDAV 账户
+func (f *LoginFlow) Wait(ctx context.Context) (models.Account, error) {
+    ticker := time.NewTicker(loginFlowPollInterval)
+    defer ticker.Stop()
+    for {
+        result, done, err := f.poll(ctx)
+        if err != nil {
+            return models.Account{}, err
+        }
+        if done {
+            // 登录名可以是邮箱等别名，WebDAV 路径使用的是用户 ID
+            userID, err := f.userID(ctx, result)
+            if err != nil {
+                return models.Account{}, err
+            }
+            return models.Account{
+                Name:     result.LoginName + "@" + strings.TrimPrefix(strings.TrimPrefix(result.Server, "https://"), "http://"),
+                // gowebdav 会对整个路径转义，这里保留原始用户 ID
+                URL:      strings.TrimSuffix(result.Server, "/") + "/remote.php/dav/files/" + userID,
+                AuthType: "basic",
+                User:     result.LoginName,
+                Pass:     result.AppPassword,
+            }, nil
+        }
+        select {
+        case <-ctx.Done():
+            return models.Account{}, ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
+
+// poll 查询一次登录结果，用户尚未完成授权时服务器返回 404
+func (f *LoginFlow) poll(ctx context.Context) (loginFlowResult, bool, error) {
+    var result loginFlowResult
+    form := url.Values{"token": {f.token}}
+    rq, err := http.NewRequestWithContext(ctx, http.MethodPost, f.endpoint, strings.NewReader(form.Encode()))
+    if err != nil {
+        return result, false, err
+    }
+    rq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    rs, err := f.client.Do(rq)
+    if err != nil {
+        return result, false, err
+    }
+    defer rs.Body.Close()
+    switch rs.StatusCode {
+    case http.StatusNotFound:
+        return result, false, nil
+    case http.StatusOK:
+        if err := json.NewDecoder(rs.Body).Decode(&result); err != nil {
+            return result, false, err
+        }
+        if result.Server == "" || result.LoginName == "" || result.AppPassword == "" {
+            return result, false, fmt.Errorf("Nextcloud 登录失败: 服务器响应不完整")
+        }
+        return result, true, nil
+    }
+    return result, false, fmt.Errorf("Nextcloud 登录失败: %s", rs.Status)
+}
+
+// userID 使用应用密码查询当前用户的 ID
+func (f *LoginFlow) userID(ctx context.Context, result loginFlowResult) (string, error) {
+    rq, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(result.Server, "/")+"/ocs/v1.php/cloud/user?format=json", nil)
+    if err != nil {
+        return "", err
+    }
+    rq.SetBasicAuth(result.LoginName, result.AppPassword)
+    rq.Header.Set("OCS-APIRequest", "true")
+    rs, err := f.client.Do(rq)
+    if err != nil {
+        return "", err
+    }
+    defer rs.Body.Close()
+    if rs.StatusCode != http.StatusOK {
+        return "", fmt.Errorf("查询 Nextcloud 用户失败: %s", rs.Status)
+    }
+    var user struct {
+        OCS struct {
+            Data struct {
+                ID string `json:"id"`
+            } `json:"data"`
+        } `json:"ocs"`
+    }
+    if err := json.NewDecoder(rs.Body).Decode(&user); err != nil {
+        return "", err
+    }
+    if user.OCS.Data.ID == "" {
+        return "", fmt.Errorf("查询 Nextcloud 用户失败: 服务器响应不完整")
+    }
+    return user.OCS.Data.ID, nil
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// loginFlowStub 模拟 Nextcloud Login Flow v2 的发起和轮询接口，
+// 前 pending 次轮询返回 404，之后返回 final 指定的状态。
+// 登录成功后可以用应用密码查询用户 ID
+type loginFlowStub struct {
+    pending int32
+    final   int
+    polls   atomic.Int32
+}
+
+func (s *loginFlowStub) serve(t *testing.T) *httptest.Server {
+    t.Helper()
+    mux := http.NewServeMux()
+    var server *httptest.Server
+    mux.HandleFunc("/index.php/login/v2", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+            t.Errorf("发起登录使用了 %s", r.Method)
+        }
+        json.NewEncoder(w).Encode(map[string]any{
+            "poll":  map[string]string{"token": "poll-token", "endpoint": server.URL + "/login/v2/poll"},
+            "login": server.URL + "/login/v2/flow/abc",
+        })
+    })
+    mux.HandleFunc("/login/v2/poll", func(w http.ResponseWriter, r *http.Request) {
+        if token := r.PostFormValue("token"); token != "poll-token" {
+            t.Errorf("轮询令牌为 %q", token)
+        }
+        if s.polls.Add(1) <= s.pending {
+            http.NotFound(w, r)
+            return
+        }
+        if s.final != http.StatusOK {
+            w.WriteHeader(s.final)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]string{
+            "server":      server.URL,
+            "loginName":   "alice@example.com",
+            "appPassword": "app-secret",
+        })
+    })
+    // 登录名是邮箱，用户 ID 与之不同
+    mux.HandleFunc("/ocs/v1.php/cloud/user", func(w http.ResponseWriter, r *http.Request) {
+        if user, pass, ok := r.BasicAuth(); !ok || user != "alice@example.com" || pass != "app-secret" {
+            t.Errorf("查询用户的凭据为 %q / %q", user, pass)
+        }
+        if r.Header.Get("OCS-APIRequest") != "true" {
+            t.Error("查询用户的请求缺少 OCS-APIRequest")
+        }
+        json.NewEncoder(w).Encode(map[string]any{
+            "ocs": map[string]any{"data": map[string]string{"id": "alice"}},
+        })
+    })
+    server = httptest.NewServer(mux)
+    t.Cleanup(server.Close)
+    return server
+}
+
+func fastLoginFlowPoll(t *testing.T) {
+    t.Helper()
+    interval := loginFlowPollInterval
+    loginFlowPollInterval = 10 * time.Millisecond
+    t.Cleanup(func() { loginFlowPollInterval = interval })
+}
+
+func TestLoginFlow(t *testing.T) {
+    fastLoginFlowPoll(t)
+    stub := &loginFlowStub{pending: 2, final: http.StatusOK}
+    server := stub.serve(t)
+
+    ctx := context.Background()
+    flow, err := StartLoginFlow(ctx, server.URL+"/", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if flow.LoginURL != server.URL+"/login/v2/flow/abc" {
+        t.Errorf("LoginURL = %q", flow.LoginURL)
+    }
+    account, err := flow.Wait(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := stub.polls.Load(); got != 3 {
+        t.Errorf("轮询 %d 次，期望 3 次", got)
+    }
+    if account.User != "alice@example.com" || account.Pass != "app-secret" || account.AuthType != "basic" {
+        t.Errorf("账户凭据 = %q / %q / %q", account.User, account.Pass, account.AuthType)
+    }
+    if want := server.URL + "/remote.php/dav/files/alice"; account.URL != want {
+        t.Errorf("URL = %q，期望 %q", account.URL, want)
+    }
+}
+
+func TestLoginFlowCancel(t *testing.T) {
+    fastLoginFlowPoll(t)
+    stub := &loginFlowStub{pending: 1 << 30, final: http.StatusOK}
+    server := stub.serve(t)
+
+    flow, err := StartLoginFlow(context.Background(), server.URL, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+    defer cancel()
+    if _, err := flow.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("Wait 返回 %v，期望超时", err)
+    }
+    if stub.polls.Load() == 0 {
+        t.Error("取消前没有轮询")
+    }
+}
+
+func TestLoginFlowExpired(t *testing.T) {
+    fastLoginFlowPoll(t)
+    // 令牌过期后服务器不再返回 404
+    stub := &loginFlowStub{pending: 1, final: http.StatusForbidden}
+    server := stub.serve(t)
+
+    flow, err := StartLoginFlow(context.Background(), server.URL, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := flow.Wait(context.Background()); err == nil {
+        t.Fatal("令牌过期时 Wait 应返回错误")
+    }
+}
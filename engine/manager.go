@@ -0,0 +1,350 @@
+package engine
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "os"
+    "sort"
+    "sync"
+
+    "github.com/rs/zerolog"
+    "WebdavSync/models"
+)
+
+// Manager 管理多个同步对，每个同步对由独立的 SyncEngine 并发运行
+type Manager struct {
+    db             *sql.DB
+    logger         zerolog.Logger
+    ctx            context.Context
+    mu             sync.Mutex
+    engines        map[int64]*SyncEngine
+    conns          map[int64]*Connection // 按账户共享的连接
+    conflicts      chan models.Conflict
+    deleteConfirms chan models.DeleteConfirmation
+    progress       progressHub // 汇总所有同步对的传输进度
+    settings       models.Settings
+    window         int  // 当前生效的计划规则下标，-1 表示不在任何时段内，scheduleModified 表示尚未应用
+    userPaused     bool // 用户手动暂停
+    schedulePaused bool // 处于计划暂停的时段
+}
+
+func NewManager(db *sql.DB) *Manager {
+    return &Manager{
+        db:             db,
+        logger:         zerolog.New(os.Stdout).With().Timestamp().Logger(),
+        ctx:            context.Background(),
+        engines:        make(map[int64]*SyncEngine),
+        conns:          make(map[int64]*Connection),
+        conflicts:      make(chan models.Conflict),
+        deleteConfirms: make(chan models.DeleteConfirmation),
+        window:         scheduleModified,
+    }
+}
+
+// Start 为数据库中的每个同步对创建并启动引擎，返回启动失败的错误
+func (m *Manager) Start(ctx context.Context) error {
+    m.mu.Lock()
+    m.ctx = ctx
+    m.mu.Unlock()
+
+    settings, err := models.LoadSettings(m.db)
+    if err != nil {
+        return err
+    }
+    m.mu.Lock()
+    m.settings = settings
+    m.mu.Unlock()
+
+    profiles, err := models.LoadProfiles(m.db)
+    if err != nil {
+        return err
+    }
+    var errs []error
+    for _, p := range profiles {
+        if err := m.startProfile(p.ID); err != nil {
+            errs = append(errs, fmt.Errorf("同步对 %s：%w", p.Name, err))
+        }
+    }
+    go m.runSchedule(ctx)
+    return errors.Join(errs...)
+}
+
+func (m *Manager) startProfile(id int64) error {
+    cfg, err := models.Load(m.db, id)
+    if err != nil {
+        return err
+    }
+    conn, err := m.connection(cfg)
+    if err != nil {
+        return err
+    }
+    eng := NewSyncEngine(id, cfg, m.db, conn)
+    m.mu.Lock()
+    m.engines[id] = eng
+    ctx := m.ctx
+    paused := m.userPaused || m.schedulePaused
+    m.mu.Unlock()
+    if paused {
+        eng.Pause()
+    }
+    go m.forward(eng)
+    go m.forwardProgress(eng)
+    if cfg.LocalDir == "" {
+        // 尚未配置的同步对只创建引擎，保存配置后再启动
+        return nil
+    }
+    return eng.Start(ctx)
+}
+
+// connection 返回配置所用账户的共享连接，同一账户的同步对共用连接池和认证状态
+func (m *Manager) connection(cfg models.Config) (*Connection, error) {
+    if cfg.AccountID == 0 {
+        return NewConnection(models.Account{URL: cfg.URL, User: cfg.User, Pass: cfg.Pass}, nil)
+    }
+    m.mu.Lock()
+    conn, ok := m.conns[cfg.AccountID]
+    m.mu.Unlock()
+    if ok {
+        return conn, nil
+    }
+    account, err := models.LoadAccount(m.db, cfg.AccountID)
+    if err != nil {
+        return nil, err
+    }
+    conn, err = m.newConnection(account)
+    if err != nil {
+        return nil, err
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    // 加载账户期间可能已有其他同步对创建了连接
+    if existing, ok := m.conns[cfg.AccountID]; ok {
+        return existing, nil
+    }
+    m.conns[cfg.AccountID] = conn
+    return conn, nil
+}
+
+// newConnection 为账户创建连接，OAuth2 刷新令牌轮换后写回数据库
+func (m *Manager) newConnection(account models.Account) (*Connection, error) {
+    return NewConnection(account, func(refreshToken string) {
+        if err := models.SaveAccountToken(m.db, account.ID, refreshToken); err != nil {
+            m.logger.Error().Err(err).Msgf("保存账户 %s 的 OAuth2 令牌失败", account.Name)
+        }
+    })
+}
+
+// forward 将单个引擎的冲突和删除确认请求汇总到管理器
+func (m *Manager) forward(eng *SyncEngine) {
+    for {
+        select {
+        case <-eng.ctx.Done():
+            return
+        case c := <-eng.Conflicts():
+            m.conflicts <- c
+        case d := <-eng.DeleteConfirmations():
+            m.deleteConfirms <- d
+        }
+    }
+}
+
+// forwardProgress 将单个引擎的传输进度汇总到管理器。与 forward 分开，
+// 等待用户处理冲突或删除确认时不会阻塞进度事件
+func (m *Manager) forwardProgress(eng *SyncEngine) {
+    progress, unsubscribe := eng.SubscribeProgress()
+    defer unsubscribe()
+    active := make(map[int64]Progress)
+    relay := func(p Progress) {
+        if p.Finished {
+            delete(active, p.TaskID)
+        } else {
+            active[p.TaskID] = p
+        }
+        m.progress.publish(p)
+    }
+    for {
+        select {
+        case <-eng.ctx.Done():
+            m.finishTransfers(progress, active, relay)
+            return
+        case p := <-progress:
+            relay(p)
+        }
+    }
+}
+
+// SubscribeProgress 订阅所有同步对的传输进度，不再需要时调用返回的函数取消订阅
+func (m *Manager) SubscribeProgress() (<-chan Progress, func()) {
+    return m.progress.subscribe()
+}
+
+func (m *Manager) Conflicts() <-chan models.Conflict {
+    return m.conflicts
+}
+
+func (m *Manager) DeleteConfirmations() <-chan models.DeleteConfirmation {
+    return m.deleteConfirms
+}
+
+// Engine 返回同步对的引擎，不存在时返回 nil
+func (m *Manager) Engine(id int64) *SyncEngine {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.engines[id]
+}
+
+// Engines 按同步对 ID 顺序返回所有引擎
+func (m *Manager) Engines() []*SyncEngine {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    engines := make([]*SyncEngine, 0, len(m.engines))
+    for _, eng := range m.engines {
+        engines = append(engines, eng)
+    }
+    sort.Slice(engines, func(i, j int) bool { return engines[i].profileID < engines[j].profileID })
+    return engines
+}
+
+// AddProfile 新建同步对并启动其引擎
+func (m *Manager) AddProfile(name string, cfg models.Config) (int64, error) {
+    id, err := models.CreateProfile(m.db, name, cfg)
+    if err != nil {
+        return 0, err
+    }
+    return id, m.startProfile(id)
+}
+
+// UpdateProfile 保存同步对的名称和配置并应用到运行中的引擎
+func (m *Manager) UpdateProfile(id int64, name string, cfg models.Config) error {
+    if err := models.RenameProfile(m.db, id, name); err != nil {
+        return err
+    }
+    if err := models.Save(m.db, id, cfg); err != nil {
+        return err
+    }
+    if err := cfg.ApplyAccount(m.db); err != nil {
+        return err
+    }
+    eng := m.Engine(id)
+    if eng != nil && eng.config.LocalDir == cfg.LocalDir {
+        if eng.config.AccountID != cfg.AccountID {
+            conn, err := m.connection(cfg)
+            if err != nil {
+                return err
+            }
+            eng.client, eng.conn = conn.Client, conn
+        }
+        eng.UpdateConfig(cfg)
+        return nil
+    }
+    // 本地目录变化后需要重新建立文件监控，直接重建引擎
+    if eng != nil {
+        eng.UpdateConfig(cfg)
+        eng.Stop()
+    }
+    return m.startProfile(id)
+}
+
+// RemoveProfile 停止同步对的引擎并删除其所有数据库记录，本地和云端文件保持不变
+func (m *Manager) RemoveProfile(id int64) error {
+    m.mu.Lock()
+    eng := m.engines[id]
+    delete(m.engines, id)
+    m.mu.Unlock()
+    if eng != nil {
+        eng.Stop()
+    }
+    return models.DeleteProfile(m.db, id)
+}
+
+// Accounts 返回所有账户
+func (m *Manager) Accounts() ([]models.Account, error) {
+    return models.LoadAccounts(m.db)
+}
+
+// SaveAccount 保存账户。修改已有账户时重建其共享连接，并将新凭据应用到所有使用该账户的同步对
+func (m *Manager) SaveAccount(account models.Account) (int64, error) {
+    // 证书文件无效时不保存，避免使用该账户的同步对全部无法连接
+    if _, err := NewTransport(account); err != nil {
+        return 0, err
+    }
+    id, err := models.SaveAccount(m.db, account)
+    if err != nil {
+        return 0, err
+    }
+    account.ID = id
+    conn, err := m.newConnection(account)
+    if err != nil {
+        return id, err
+    }
+    m.mu.Lock()
+    m.conns[id] = conn
+    m.mu.Unlock()
+
+    profiles, err := models.AccountProfiles(m.db, id)
+    if err != nil {
+        return id, err
+    }
+    for _, profileID := range profiles {
+        if eng := m.Engine(profileID); eng != nil {
+            eng.setAccount(account, conn)
+        }
+    }
+    return id, nil
+}
+
+// RemoveAccount 删除未被任何同步对使用的账户
+func (m *Manager) RemoveAccount(id int64) error {
+    if err := models.DeleteAccount(m.db, id); err != nil {
+        return err
+    }
+    m.mu.Lock()
+    delete(m.conns, id)
+    m.mu.Unlock()
+    return nil
+}
+
+// Settings 返回全局设置
+func (m *Manager) Settings() (models.Settings, error) {
+    return models.LoadSettings(m.db)
+}
+
+// SaveSettings 保存全局设置，并立即应用到所有同步对，包括进行中的传输
+func (m *Manager) SaveSettings(settings models.Settings) error {
+    if err := models.SaveSettings(m.db, settings); err != nil {
+        return err
+    }
+    m.mu.Lock()
+    m.settings = settings
+    m.window = scheduleModified
+    m.mu.Unlock()
+    m.applySchedule()
+    m.logger.Info().Msgf("限速已更新：上传 %d KB/s，下载 %d KB/s，计划 %d 条", settings.UploadLimit, settings.DownloadLimit, len(settings.Schedule))
+    return nil
+}
+
+// Pause 暂停所有同步对
+func (m *Manager) Pause() {
+    m.setPaused(func() { m.userPaused = true })
+}
+
+// Resume 恢复所有同步对，同时解除取消批量删除后保持的暂停。处于计划暂停的时段时，同步在时段结束后才恢复
+func (m *Manager) Resume() {
+    m.setPaused(func() { m.userPaused = false })
+    for _, eng := range m.Engines() {
+        eng.unhold()
+    }
+}
+
+// IsPaused 判断是否已手动暂停同步，或有同步对因批量删除保持暂停
+func (m *Manager) IsPaused() bool {
+    m.mu.Lock()
+    paused := m.userPaused
+    m.mu.Unlock()
+    for _, eng := range m.Engines() {
+        paused = paused || eng.Held()
+    }
+    return paused
+}
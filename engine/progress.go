@@ -0,0 +1,184 @@
+package engine
+
+import (
+    "context"
+    "io"
+    "sync"
+    "time"
+)
+
+const (
+    progressInterval = 500 * time.Millisecond // 同一传输两次进度事件之间的最短间隔
+    progressGrace    = 2 * time.Second        // 引擎停止后等待进行中的传输发布结束事件的时间
+    progressBuffer   = 64                     // 每个订阅者的事件缓冲，订阅者处理不及时时丢弃中间的进度更新
+)
+
+// Progress 是一次上传或下载的进度事件
+type Progress struct {
+    ProfileID int64         // 所属同步对 ID
+    TaskID    int64         // 任务 ID
+    Path      string        // 文件路径（相对于同步目录）
+    Operation string        // upload 或 download
+    Done      int64         // 已传输的字节数，断点续传时包含之前已完成的部分
+    Total     int64         // 总字节数，未知时为 -1
+    Rate      float64       // 最近的传输速率（字节/秒）
+    ETA       time.Duration // 预计剩余时间，无法估计时为 -1
+    Finished  bool          // 传输已结束，Err 为 nil 表示成功
+    Err       error
+}
+
+// progressHub 把进度事件分发给所有订阅者，进度更新的发送不会阻塞传输
+type progressHub struct {
+    mu   sync.Mutex
+    subs map[chan Progress]struct{}
+}
+
+// subscribe 返回进度事件通道和取消订阅的函数，取消后通道被关闭
+func (h *progressHub) subscribe() (<-chan Progress, func()) {
+    ch := make(chan Progress, progressBuffer)
+    h.mu.Lock()
+    if h.subs == nil {
+        h.subs = make(map[chan Progress]struct{})
+    }
+    h.subs[ch] = struct{}{}
+    h.mu.Unlock()
+    var once sync.Once
+    return ch, func() {
+        once.Do(func() {
+            h.mu.Lock()
+            delete(h.subs, ch)
+            h.mu.Unlock()
+            close(ch)
+        })
+    }
+}
+
+// publish 把事件发给所有订阅者。缓冲已满时丢弃进度更新；结束事件最多等待 progressGrace，
+// 订阅者不会因为漏掉结束事件而一直显示已结束的传输
+func (h *progressHub) publish(p Progress) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    var timeout <-chan time.Time
+    if p.Finished {
+        timeout = time.After(progressGrace)
+    }
+    for ch := range h.subs {
+        if timeout == nil {
+            select {
+            case ch <- p:
+            default:
+            }
+            continue
+        }
+        select {
+        case ch <- p:
+        case <-timeout:
+        }
+    }
+}
+
+// finishTransfers 在引擎停止后继续转发进度，直到进行中的传输都已结束。
+// 超过 progressGrace 仍未结束的传输以取消结束，订阅者不会留下过期的传输
+func (m *Manager) finishTransfers(progress <-chan Progress, active map[int64]Progress, relay func(Progress)) {
+    timeout := time.After(progressGrace)
+    for len(active) > 0 {
+        select {
+        case p := <-progress:
+            relay(p)
+        case <-timeout:
+            for _, p := range active {
+                p.Finished = true
+                p.Err = context.Canceled
+                relay(p)
+            }
+            return
+        }
+    }
+}
+
+// SubscribeProgress 订阅本同步对的传输进度，不再需要时调用返回的函数取消订阅
+func (se *SyncEngine) SubscribeProgress() (<-chan Progress, func()) {
+    return se.progress.subscribe()
+}
+
+// transfer 记录一次传输的进度，按 progressInterval 发布事件
+type transfer struct {
+    hub      *progressHub
+    p        Progress
+    lastTime time.Time
+    lastDone int64
+}
+
+// newTransfer 开始记录一次传输，done 为断点续传时已完成的字节数
+func (se *SyncEngine) newTransfer(taskID int64, path, operation string, done, total int64) *transfer {
+    t := &transfer{
+        hub: &se.progress,
+        p: Progress{
+            ProfileID: se.profileID,
+            TaskID:    taskID,
+            Path:      path,
+            Operation: operation,
+            Done:      done,
+            Total:     total,
+            ETA:       -1,
+        },
+        lastTime: time.Now(),
+        lastDone: done,
+    }
+    t.hub.publish(t.p)
+    return t
+}
+
+// add 记录新传输的字节数
+func (t *transfer) add(n int64) {
+    t.p.Done += n
+    now := time.Now()
+    elapsed := now.Sub(t.lastTime)
+    if elapsed < progressInterval {
+        return
+    }
+    // 指数平均，避免速率随每次采样剧烈跳动
+    rate := float64(t.p.Done-t.lastDone) / elapsed.Seconds()
+    if t.p.Rate == 0 {
+        t.p.Rate = rate
+    } else {
+        t.p.Rate = 0.7*t.p.Rate + 0.3*rate
+    }
+    t.p.ETA = -1
+    if t.p.Total >= 0 && t.p.Rate > 0 {
+        t.p.ETA = time.Duration(float64(max(t.p.Total-t.p.Done, 0)) / t.p.Rate * float64(time.Second))
+    }
+    t.lastTime, t.lastDone = now, t.p.Done
+    t.hub.publish(t.p)
+}
+
+// restart 从头重新记录进度，用于增量上传回退到完整上传
+func (t *transfer) restart() {
+    t.p.Done, t.p.Rate, t.p.ETA = 0, 0, -1
+    t.lastTime, t.lastDone = time.Now(), 0
+}
+
+// finish 发布传输结束的事件
+func (t *transfer) finish(err error) {
+    t.p.Finished = true
+    t.p.Err = err
+    if err == nil {
+        t.p.ETA = 0
+        if t.p.Total < 0 {
+            t.p.Total = t.p.Done
+        }
+    }
+    t.hub.publish(t.p)
+}
+
+// progressReader 在读取数据的同时记录传输进度
+type progressReader struct {
+    r io.Reader
+    t *transfer
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+    n, err := r.r.Read(p)
+    r.t.add(int64(n))
+    return n, err
+}
@@ -0,0 +1,33 @@
+package engine
+
+import (
+    "fmt"
+    "net/http"
+    "net/url"
+
+    "WebdavSync/models"
+)
+
+// applyProxy 按账户的代理方式设置传输层代理。
+// system 使用 HTTP_PROXY/HTTPS_PROXY/NO_PROXY 环境变量，manual 使用账户中的代理地址和凭据，none 直接连接
+func applyProxy(transport *http.Transport, account models.Account) error {
+    switch account.ProxyMode {
+    case "", "system":
+        transport.Proxy = http.ProxyFromEnvironment
+    case "none":
+        transport.Proxy = nil
+    case "manual":
+        proxyURL, err := url.Parse(account.ProxyURL)
+        if err != nil || proxyURL.Host == "" {
+            return fmt.Errorf("代理地址无效：%s", account.ProxyURL)
+        }
+        // 带用户信息的代理地址会让传输层自动发送 Proxy-Authorization
+        if account.ProxyUser != "" {
+            proxyURL.User = url.UserPassword(account.ProxyUser, account.ProxyPass)
+        }
+        transport.Proxy = http.ProxyURL(proxyURL)
+    default:
+        return fmt.Errorf("未知的代理方式：%s", account.ProxyMode)
+    }
+    return nil
+}
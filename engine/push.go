@@ -0,0 +1,216 @@
+package engine
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gorilla/websocket"
+)
+
+const (
+    pushRetryInterval = 30 * time.Second // 推送通道不可用时重新尝试连接的间隔
+    pushIdleTimeout   = 5 * time.Minute  // 超过此时间没有收到任何消息（含 ping）视为连接已断开
+)
+
+// errPushUnavailable 表示服务器没有启用 notify_push
+var errPushUnavailable = errors.New("服务器未启用 notify_push")
+
+// pushEndpoints 是 Nextcloud capabilities 中 notify_push 的地址
+type pushEndpoints struct {
+    Websocket string `json:"websocket"`
+    PreAuth   string `json:"pre_auth"`
+}
+
+// serverRoot 从 WebDAV 地址中取出 Nextcloud 服务器根地址
+func serverRoot(davURL string) (string, bool) {
+    i := strings.Index(davURL, "/remote.php/")
+    if i < 0 {
+        return "", false
+    }
+    return davURL[:i], true
+}
+
+// pushEndpoints 通过 capabilities 接口查询 notify_push 的 websocket 地址
+func (c *Connection) pushEndpoints() (pushEndpoints, error) {
+    var caps struct {
+        OCS struct {
+            Data struct {
+                Capabilities struct {
+                    NotifyPush struct {
+                        Endpoints pushEndpoints `json:"endpoints"`
+                    } `json:"notify_push"`
+                } `json:"capabilities"`
+            } `json:"data"`
+        } `json:"ocs"`
+    }
+    server, ok := serverRoot(c.account.URL)
+    if !ok {
+        return pushEndpoints{}, errPushUnavailable
+    }
+    rs, err := c.do(http.MethodGet, server+"/ocs/v2.php/cloud/capabilities?format=json", "/ocs/v2.php/cloud/capabilities", nil,
+        http.Header{"OCS-APIRequest": {"true"}, "Accept": {"application/json"}})
+    if err != nil {
+        return pushEndpoints{}, err
+    }
+    defer rs.Body.Close()
+    if rs.StatusCode != http.StatusOK {
+        return pushEndpoints{}, fmt.Errorf("查询服务器功能失败: %s", rs.Status)
+    }
+    if err := json.NewDecoder(rs.Body).Decode(&caps); err != nil {
+        return pushEndpoints{}, err
+    }
+    endpoints := caps.OCS.Data.Capabilities.NotifyPush.Endpoints
+    if endpoints.Websocket == "" {
+        return pushEndpoints{}, errPushUnavailable
+    }
+    return endpoints, nil
+}
+
+// pushCredentials 返回登录推送通道的用户名和密码。
+// 非密码认证的账户先向 pre_auth 接口换取一次性令牌，以空用户名登录
+func (c *Connection) pushCredentials(endpoints pushEndpoints) (string, string, error) {
+    switch c.account.AuthType {
+    case "", "basic", "digest":
+        return c.account.User, c.account.Pass, nil
+    }
+    if endpoints.PreAuth == "" {
+        return "", "", errPushUnavailable
+    }
+    rs, err := c.do(http.MethodPost, endpoints.PreAuth, "/apps/notify_push/pre_auth", nil, http.Header{"OCS-APIRequest": {"true"}})
+    if err != nil {
+        return "", "", err
+    }
+    defer rs.Body.Close()
+    if rs.StatusCode != http.StatusOK {
+        return "", "", fmt.Errorf("获取推送令牌失败: %s", rs.Status)
+    }
+    token, err := io.ReadAll(io.LimitReader(rs.Body, 4096))
+    if err != nil {
+        return "", "", err
+    }
+    return "", strings.TrimSpace(string(token)), nil
+}
+
+// dialPush 使用账户的 TLS 和代理设置连接推送通道并登录
+func (c *Connection) dialPush(ctx context.Context) (*websocket.Conn, error) {
+    endpoints, err := c.pushEndpoints()
+    if err != nil {
+        return nil, err
+    }
+    user, pass, err := c.pushCredentials(endpoints)
+    if err != nil {
+        return nil, err
+    }
+    dialer := websocket.Dialer{
+        Proxy:            c.base.Proxy,
+        TLSClientConfig:  c.base.TLSClientConfig,
+        HandshakeTimeout: 30 * time.Second,
+    }
+    ws, _, err := dialer.DialContext(ctx, endpoints.Websocket, nil)
+    if err != nil {
+        return nil, err
+    }
+    for _, message := range []string{user, pass} {
+        if err := ws.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+            ws.Close()
+            return nil, err
+        }
+    }
+    ws.SetReadDeadline(time.Now().Add(pushIdleTimeout))
+    _, reply, err := ws.ReadMessage()
+    if err != nil {
+        ws.Close()
+        return nil, err
+    }
+    if string(reply) != "authenticated" {
+        ws.Close()
+        return nil, fmt.Errorf("推送通道登录失败: %s", reply)
+    }
+    return ws, nil
+}
+
+// listenPush 在启用推送时保持与 notify_push 的连接，收到文件变更通知后立即轮询云端。
+// 连接失败或断开时回退到轮询，并定期重试
+func (se *SyncEngine) listenPush(ctx context.Context) {
+    var lastErr string
+    for {
+        if se.config.Push && se.reachable() {
+            err := se.runPush(ctx)
+            if ctx.Err() != nil {
+                return
+            }
+            // 相同的错误只记录一次，避免服务器未启用推送时反复输出
+            if err.Error() != lastErr {
+                se.logger.Warn().Err(err).Msg("推送通道不可用，改为轮询云端")
+                lastErr = err.Error()
+            }
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(pushRetryInterval):
+        }
+    }
+}
+
+// runPush 连接推送通道并处理通知，直到连接断开
+func (se *SyncEngine) runPush(ctx context.Context) error {
+    conn := se.conn
+    ws, err := conn.dialPush(ctx)
+    if err != nil {
+        return err
+    }
+    defer ws.Close()
+    stop := context.AfterFunc(ctx, func() {
+        ws.Close()
+    })
+    defer stop()
+    ws.SetPingHandler(func(data string) error {
+        ws.SetReadDeadline(time.Now().Add(pushIdleTimeout))
+        return ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(10*time.Second))
+    })
+
+    se.pushActive.Store(true)
+    se.logger.Info().Msg("已连接推送通道")
+    defer func() {
+        se.pushActive.Store(false)
+        // 断开期间的变化需要由轮询补上
+        se.notifyRemoteChange()
+    }()
+    // 连接建立前的变化不会推送，立即检查一次
+    se.notifyRemoteChange()
+
+    for {
+        ws.SetReadDeadline(time.Now().Add(pushIdleTimeout))
+        _, message, err := ws.ReadMessage()
+        if err != nil {
+            return err
+        }
+        // 切换账户或关闭推送后断开，由 listenPush 按新设置重新连接
+        if se.conn != conn || !se.config.Push {
+            return errors.New("推送设置已变更")
+        }
+        text := string(message)
+        // notify_file_id 携带的是服务器文件 ID，files 表没有记录 ID，无法映射到路径，
+        // 与 notify_file 一样触发一次轮询，由 sync-collection 找出实际变化的文件
+        if text == "notify_file" || strings.HasPrefix(text, "notify_file_id") {
+            se.notifyRemoteChange()
+        } else if strings.HasPrefix(text, "err:") {
+            return fmt.Errorf("推送通道错误: %s", text)
+        }
+    }
+}
+
+// notifyRemoteChange 通知轮询循环立即检查云端
+func (se *SyncEngine) notifyRemoteChange() {
+    select {
+    case se.remoteActivity <- struct{}{}:
+    default:
+    }
+}
@@ -0,0 +1,157 @@
+package engine
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/websocket"
+    "github.com/rs/zerolog"
+    "WebdavSync/models"
+)
+
+// pushStub 模拟启用了 notify_push 的 Nextcloud：capabilities 接口返回 websocket 地址，
+// 登录成功后把 messages 中的消息依次发给客户端，messages 关闭时断开连接
+type pushStub struct {
+    server   *httptest.Server
+    logins   chan [2]string
+    messages chan string
+}
+
+func newPushStub(t *testing.T) *pushStub {
+    t.Helper()
+    stub := &pushStub{logins: make(chan [2]string, 1), messages: make(chan string)}
+    mux := http.NewServeMux()
+    mux.HandleFunc("/ocs/v2.php/cloud/capabilities", func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("OCS-APIRequest") != "true" {
+            t.Error("capabilities 请求缺少 OCS-APIRequest")
+        }
+        ws := "ws" + strings.TrimPrefix(stub.server.URL, "http") + "/push/ws"
+        json.NewEncoder(w).Encode(map[string]any{
+            "ocs": map[string]any{"data": map[string]any{"capabilities": map[string]any{
+                "notify_push": map[string]any{"endpoints": map[string]string{"websocket": ws}},
+            }}},
+        })
+    })
+    upgrader := websocket.Upgrader{}
+    mux.HandleFunc("/push/ws", func(w http.ResponseWriter, r *http.Request) {
+        ws, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            t.Error(err)
+            return
+        }
+        defer ws.Close()
+        var login [2]string
+        for i := range login {
+            _, message, err := ws.ReadMessage()
+            if err != nil {
+                t.Error(err)
+                return
+            }
+            login[i] = string(message)
+        }
+        stub.logins <- login
+        ws.WriteMessage(websocket.TextMessage, []byte("authenticated"))
+        for message := range stub.messages {
+            ws.WriteMessage(websocket.TextMessage, []byte(message))
+        }
+    })
+    stub.server = httptest.NewServer(mux)
+    t.Cleanup(stub.server.Close)
+    return stub
+}
+
+func (s *pushStub) engine(t *testing.T) *SyncEngine {
+    t.Helper()
+    conn, err := NewConnection(models.Account{URL: s.server.URL + "/remote.php/dav/files/alice", User: "alice", Pass: "secret"}, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &SyncEngine{
+        conn:           conn,
+        config:         models.Config{Push: true},
+        logger:         zerolog.Nop(),
+        health:         HealthOnline,
+        remoteActivity: make(chan struct{}, 1),
+    }
+}
+
+// expectActivity 等待引擎收到立即轮询的通知
+func expectActivity(t *testing.T, se *SyncEngine, what string) {
+    t.Helper()
+    select {
+    case <-se.remoteActivity:
+    case <-time.After(2 * time.Second):
+        t.Fatalf("%s后没有触发轮询", what)
+    }
+}
+
+func TestPushNotify(t *testing.T) {
+    stub := newPushStub(t)
+    se := stub.engine(t)
+    done := make(chan error, 1)
+    go func() { done <- se.runPush(context.Background()) }()
+
+    if login := <-stub.logins; login != [2]string{"alice", "secret"} {
+        t.Fatalf("登录凭据 = %q", login)
+    }
+    // 连接建立后立即检查一次
+    expectActivity(t, se, "连接")
+    if !se.pushActive.Load() {
+        t.Fatal("连接后 pushActive 应为 true")
+    }
+    stub.messages <- "notify_file"
+    expectActivity(t, se, "notify_file")
+
+    stub.messages <- "err: push server shutting down"
+    if err := <-done; err == nil || !strings.Contains(err.Error(), "shutting down") {
+        t.Fatalf("runPush 返回 %v", err)
+    }
+    if se.pushActive.Load() {
+        t.Fatal("断开后 pushActive 应为 false")
+    }
+    // 断开期间的变化由轮询补上
+    expectActivity(t, se, "断开")
+    close(stub.messages)
+}
+
+func TestPushDisconnect(t *testing.T) {
+    stub := newPushStub(t)
+    se := stub.engine(t)
+    done := make(chan error, 1)
+    go func() { done <- se.runPush(context.Background()) }()
+
+    <-stub.logins
+    expectActivity(t, se, "连接")
+    close(stub.messages)
+    select {
+    case err := <-done:
+        if err == nil {
+            t.Fatal("连接断开时 runPush 应返回错误")
+        }
+    case <-time.After(2 * time.Second):
+        t.Fatal("连接断开后 runPush 没有返回")
+    }
+    if se.pushActive.Load() {
+        t.Fatal("断开后 pushActive 应为 false")
+    }
+    expectActivity(t, se, "断开")
+}
+
+func TestPushUnavailable(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte(`{"ocs":{"data":{"capabilities":{}}}}`))
+    }))
+    defer server.Close()
+    conn, err := NewConnection(models.Account{URL: server.URL + "/remote.php/dav/files/alice", User: "alice", Pass: "secret"}, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := conn.dialPush(context.Background()); err != errPushUnavailable {
+        t.Fatalf("dialPush 返回 %v，期望 errPushUnavailable", err)
+    }
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+    "context"
+    "io"
+    "sync"
+    "time"
+)
+
+// rateChunk 是每次申请配额的最大字节数，限速调整后最多一个分块就会按新速率执行
+const rateChunk = 32 << 10
+
+// uploadLimiter 和 downloadLimiter 由所有同步对的传输共享
+var (
+    uploadLimiter   = &rateLimiter{}
+    downloadLimiter = &rateLimiter{}
+)
+
+// SetBandwidthLimits 设置全局上传和下载限速（字节/秒），0 表示不限速，对进行中的传输立即生效
+func SetBandwidthLimits(upload, download int64) {
+    uploadLimiter.setRate(upload)
+    downloadLimiter.setRate(download)
+}
+
+// rateLimiter 是令牌桶限速器，桶容量为一秒的流量
+type rateLimiter struct {
+    mu     sync.Mutex
+    rate   int64 // 字节/秒，0 表示不限速
+    tokens float64
+    last   time.Time
+}
+
+func (l *rateLimiter) setRate(rate int64) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.rate = max(rate, 0)
+    l.tokens = min(l.tokens, float64(l.rate))
+}
+
+// reserve 取出 n 字节的配额，返回配额不足时需要等待的时间
+func (l *rateLimiter) reserve(n int) time.Duration {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.rate == 0 {
+        return 0
+    }
+    now := time.Now()
+    if !l.last.IsZero() {
+        l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*float64(l.rate), float64(l.rate))
+    }
+    l.last = now
+    l.tokens -= float64(n)
+    if l.tokens >= 0 {
+        return 0
+    }
+    return time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+}
+
+// wait 等待直到可以传输 n 字节，ctx 取消时提前返回
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+    for n > 0 {
+        chunk := min(n, rateChunk)
+        n -= chunk
+        delay := l.reserve(chunk)
+        if delay <= 0 {
+            continue
+        }
+        timer := time.NewTimer(delay)
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return ctx.Err()
+        case <-timer.C:
+        }
+    }
+    return nil
+}
+
+// limitedReader 按限速器的速率读取数据
+type limitedReader struct {
+    ctx     context.Context
+    r       io.Reader
+    limiter *rateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+    if len(p) > rateChunk {
+        p = p[:rateChunk]
+    }
+    n, err := r.r.Read(p)
+    if n > 0 {
+        if werr := r.limiter.wait(r.ctx, n); werr != nil {
+            return n, werr
+        }
+    }
+    return n, err
+}
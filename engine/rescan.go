@@ -0,0 +1,142 @@
+package engine
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/fsnotify/fsnotify"
+    "WebdavSync/models"
+)
+
+// rescanLocal 在启动时、按配置的间隔以及文件监控丢失事件后重新扫描本地同步目录
+func (se *SyncEngine) rescanLocal(ctx context.Context) {
+    // 启动时扫描一次，发现程序未运行期间的本地变更
+    se.scanLocal()
+    for {
+        var scheduled <-chan time.Time
+        if minutes := se.config.RescanInterval; minutes > 0 {
+            scheduled = time.After(time.Duration(minutes) * time.Minute)
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-se.rescanRequests:
+        case <-scheduled:
+        }
+        se.scanLocal()
+    }
+}
+
+// requestRescan 请求尽快重新扫描本地目录
+func (se *SyncEngine) requestRescan() {
+    select {
+    case se.rescanRequests <- struct{}{}:
+    default:
+    }
+}
+
+// scanLocal 比较本地同步目录与 files 表中的记录，只对大小或修改时间不一致的文件重新计算哈希，
+// 确有变化时生成与文件监控相同的事件。扫描范围与文件监控一致，只包含同步目录的直接子项
+func (se *SyncEngine) scanLocal() {
+    if se.suspended() {
+        return
+    }
+    if err := se.verifyLocalRoot(); err != nil {
+        // 本地根目录不可用时缺失的文件不能视为已删除
+        return
+    }
+    records, err := se.getLocalFilesFromDB()
+    if err != nil {
+        se.logger.Error().Err(err).Msg("获取文件列表失败")
+        return
+    }
+    entries, err := os.ReadDir(se.localDir)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("扫描本地目录失败")
+        return
+    }
+
+    known := make(map[string]models.FileInfo, len(records))
+    for _, lf := range records {
+        known[lf.Path] = lf
+    }
+    present := make(map[string]bool, len(entries))
+    var events []fsnotify.Event
+    for _, entry := range entries {
+        if !entry.Type().IsRegular() {
+            continue
+        }
+        name := entry.Name()
+        present[name] = true
+        if se.outOfScope(name, false) {
+            continue
+        }
+        info, err := entry.Info()
+        if err != nil {
+            continue
+        }
+        path := filepath.Join(se.localDir, name)
+        lf, ok := known[name]
+        if !ok || lf.Status == "local_deleted" {
+            events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Create})
+            continue
+        }
+        if lf.Status == "skipped" {
+            // 过滤规则放宽后不再跳过的文件按本地修改处理
+            if se.filterReason(name, info.Size(), info.ModTime()) == "" {
+                events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Write})
+            }
+            continue
+        }
+        if info.Size() == lf.LocalSize && info.ModTime().Unix() == lf.LocalMtime {
+            continue
+        }
+        if se.localChanged(lf) {
+            events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Write})
+        }
+    }
+    for _, lf := range records {
+        // 本地没有副本的跳过记录由云端比较按云端文件的大小和时间重新检查
+        if present[lf.Path] || lf.LocalMtime <= 0 || se.outOfScope(lf.Path, false) {
+            continue
+        }
+        switch lf.Status {
+        case "local_deleted", "remote_deleted", "skipped":
+            continue
+        }
+        events = append(events, fsnotify.Event{Name: filepath.Join(se.localDir, lf.Path), Op: fsnotify.Remove})
+    }
+
+    if len(events) == 0 {
+        return
+    }
+    se.logger.Info().Msgf("重新扫描发现 %d 个未通知的本地变更", len(events))
+    for _, event := range events {
+        if se.suspended() {
+            return
+        }
+        se.handleLocalChange(event)
+    }
+}
+
+// localChanged 重新计算大小或修改时间可疑的文件的哈希。内容未变时只更新记录的大小和修改时间
+func (se *SyncEngine) localChanged(lf models.FileInfo) bool {
+    hash, info, err := se.localHash(lf.Path)
+    if err != nil {
+        se.logger.Error().Err(err).Msgf("计算文件 %s 的哈希失败", lf.Path)
+        return false
+    }
+    // 下载的文件没有记录本地哈希，同步完成后未再修改时以当前内容为准
+    baseline := lf.LocalHash == "" && lf.Status == "synced" && info.ModTime().Unix() <= lf.LastSync
+    if hash != lf.LocalHash && !baseline {
+        return true
+    }
+    _, err = se.db.Exec("UPDATE files SET local_hash = ?, local_mtime = ?, local_size = ? WHERE profile_id = ? AND path = ?",
+        hash, info.ModTime().Unix(), info.Size(), se.profileID, lf.Path)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("更新文件状态失败")
+    }
+    return false
+}
@@ -0,0 +1,170 @@
+package engine
+
+import (
+    "crypto/rand"
+    "database/sql"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/studio-b12/gowebdav"
+)
+
+// MarkerFileName 是写在本地和云端同步根目录下的标记文件，内容为同步对的根标识
+const MarkerFileName = ".webdavsync"
+
+// errRootMismatch 表示同步根目录缺失或与记录的根标识不一致
+var errRootMismatch = errors.New("同步根目录校验失败")
+
+// RootError 返回同步根目录检查失败的原因，nil 表示正常
+func (se *SyncEngine) RootError() error {
+    se.rootMu.Lock()
+    defer se.rootMu.Unlock()
+    return se.rootErr
+}
+
+func (se *SyncEngine) setRootError(err error) {
+    se.rootMu.Lock()
+    defer se.rootMu.Unlock()
+    if err != nil && (se.rootErr == nil || se.rootErr.Error() != err.Error()) {
+        se.logger.Error().Err(err).Msg("同步根目录检查失败，已停止同步删除")
+    } else if err == nil && se.rootErr != nil {
+        se.logger.Info().Msg("同步根目录检查恢复正常")
+    }
+    se.rootErr = err
+}
+
+// verifyRoots 校验本地和云端根目录的标记文件，首次运行时创建标记。
+// 网络错误不会使同步对进入错误状态，由调用方按网络断开处理。
+func (se *SyncEngine) verifyRoots() error {
+    err := se.checkRoots()
+    if err == nil || errors.Is(err, errRootMismatch) {
+        se.setRootError(err)
+    }
+    return err
+}
+
+// verifyLocalRoot 只校验本地根目录，用于处理本地删除事件时避免访问网络
+func (se *SyncEngine) verifyLocalRoot() error {
+    rootID, err := se.loadRootID()
+    if err != nil || rootID == "" {
+        return err
+    }
+    localID, err := se.readLocalMarker()
+    if err != nil {
+        err = fmt.Errorf("%w：本地目录 %s 缺少标记文件 %s", errRootMismatch, se.localDir, MarkerFileName)
+    } else if localID != rootID {
+        err = fmt.Errorf("%w：本地目录 %s 的标记与同步对不一致", errRootMismatch, se.localDir)
+    }
+    if err != nil {
+        se.setRootError(err)
+    }
+    return err
+}
+
+func (se *SyncEngine) checkRoots() error {
+    if _, err := os.Stat(se.localDir); err != nil {
+        return fmt.Errorf("%w：本地目录不可用：%v", errRootMismatch, err)
+    }
+    rootID, err := se.loadRootID()
+    if err != nil {
+        return err
+    }
+    localID, localErr := se.readLocalMarker()
+    if localErr != nil && !os.IsNotExist(localErr) {
+        return localErr
+    }
+    remoteID, remoteErr := se.readRemoteMarker()
+    if remoteErr != nil && !gowebdav.IsErrNotFound(remoteErr) {
+        return remoteErr
+    }
+
+    if rootID == "" {
+        // 首次运行：沿用已有的标记（例如其他客户端创建的），否则生成新的根标识
+        switch {
+        case remoteErr == nil:
+            rootID = remoteID
+        case localErr == nil:
+            rootID = localID
+        default:
+            rootID, err = newRootID()
+            if err != nil {
+                return err
+            }
+        }
+        if localErr != nil || localID != rootID {
+            if err := os.WriteFile(filepath.Join(se.localDir, MarkerFileName), []byte(rootID), 0644); err != nil {
+                return err
+            }
+        }
+        if remoteErr != nil || remoteID != rootID {
+            if err := se.client.Write(filepath.Join(se.remoteDir, MarkerFileName), []byte(rootID), 0644); err != nil {
+                return err
+            }
+        }
+        if err := se.saveRootID(rootID); err != nil {
+            return err
+        }
+        se.logger.Info().Msgf("已创建同步根标识 %s", rootID)
+        return nil
+    }
+
+    if localErr != nil {
+        return fmt.Errorf("%w：本地目录 %s 缺少标记文件 %s", errRootMismatch, se.localDir, MarkerFileName)
+    }
+    if localID != rootID {
+        return fmt.Errorf("%w：本地目录 %s 的标记与同步对不一致", errRootMismatch, se.localDir)
+    }
+    if remoteErr != nil {
+        return fmt.Errorf("%w：云端目录 %s 缺少标记文件 %s", errRootMismatch, se.remoteDir, MarkerFileName)
+    }
+    if remoteID != rootID {
+        return fmt.Errorf("%w：云端目录 %s 的标记与同步对不一致", errRootMismatch, se.remoteDir)
+    }
+    return nil
+}
+
+func (se *SyncEngine) readLocalMarker() (string, error) {
+    data, err := os.ReadFile(filepath.Join(se.localDir, MarkerFileName))
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimSpace(string(data)), nil
+}
+
+func (se *SyncEngine) readRemoteMarker() (string, error) {
+    data, err := se.client.Read(filepath.Join(se.remoteDir, MarkerFileName))
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimSpace(string(data)), nil
+}
+
+func (se *SyncEngine) loadRootID() (string, error) {
+    var rootID string
+    err := se.db.QueryRow("SELECT value FROM config WHERE profile_id = ? AND key = 'root_id'", se.profileID).Scan(&rootID)
+    if err == sql.ErrNoRows {
+        return "", nil
+    }
+    return rootID, err
+}
+
+func (se *SyncEngine) saveRootID(rootID string) error {
+    if rootID == "" {
+        _, err := se.db.Exec("DELETE FROM config WHERE profile_id = ? AND key = 'root_id'", se.profileID)
+        return err
+    }
+    _, err := se.db.Exec("INSERT OR REPLACE INTO config (profile_id, key, value) VALUES (?, 'root_id', ?)", se.profileID, rootID)
+    return err
+}
+
+func newRootID() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
+}
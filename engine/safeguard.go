@@ -0,0 +1,142 @@
+package engine
+
+import (
+    "time"
+
+    "WebdavSync/models"
+)
+
+// deleteWindow 是统计删除任务的同步周期长度
+const deleteWindow = 3 * time.Second
+
+// minFilesForPercent 是按百分比判断批量删除时要求的最少文件数，避免文件很少时误报
+const minFilesForPercent = 10
+
+func isDeleteOperation(operation string) bool {
+    return operation == "delete_local" || operation == "delete_remote"
+}
+
+func (se *SyncEngine) DeleteConfirmations() <-chan models.DeleteConfirmation {
+    return se.deleteConfirms
+}
+
+// holdDelete 暂缓删除任务，等待本周期结束后统一检查
+func (se *SyncEngine) holdDelete(task models.Task) {
+    se.deleteMu.Lock()
+    se.heldDeletes = append(se.heldDeletes, task)
+    se.deleteMu.Unlock()
+}
+
+// loadHeldDeletes 恢复上次退出时仍在等待确认的删除任务
+func (se *SyncEngine) loadHeldDeletes() {
+    rows, err := se.db.Query("SELECT id, path, operation, status, retries, last_attempt, chunk_offset FROM tasks WHERE profile_id = ? AND status = 'held'", se.profileID)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("恢复暂缓删除任务失败")
+        return
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var task models.Task
+        if err := rows.Scan(&task.ID, &task.Path, &task.Operation, &task.Status, &task.Retries, &task.LastAttempt, &task.ChunkOffset); err != nil {
+            se.logger.Error().Err(err).Msg("恢复暂缓删除任务失败")
+            return
+        }
+        se.holdDelete(task)
+    }
+}
+
+// guardDeletes 在每个同步周期结束时检查删除数量，超过阈值时暂停同步并请求确认
+func (se *SyncEngine) guardDeletes() {
+    ticker := time.NewTicker(deleteWindow)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-se.ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        se.deleteMu.Lock()
+        held := se.heldDeletes
+        se.heldDeletes = nil
+        se.deleteMu.Unlock()
+        if len(held) == 0 {
+            continue
+        }
+        if se.RootError() != nil {
+            // 同步根目录异常时删除任务继续暂缓，等待恢复
+            se.deleteMu.Lock()
+            se.heldDeletes = append(held, se.heldDeletes...)
+            se.deleteMu.Unlock()
+            continue
+        }
+
+        total, err := se.countFiles()
+        if err != nil {
+            se.logger.Error().Err(err).Msg("统计文件数量失败")
+        }
+        if !se.exceedsDeleteLimit(len(held), total) {
+            se.releaseDeletes(held)
+            for _, task := range held {
+                se.enqueue(task)
+            }
+            continue
+        }
+
+        se.logger.Warn().Msgf("本周期待删除 %d 个文件（共 %d 个），已暂停同步等待确认", len(held), total)
+        se.hold()
+        choice := make(chan bool)
+        select {
+        case <-se.ctx.Done():
+            return
+        case se.deleteConfirms <- models.DeleteConfirmation{ProfileID: se.profileID, Tasks: held, Total: total, Choice: choice}:
+        }
+        if <-choice {
+            se.logger.Info().Msgf("已确认删除 %d 个文件", len(held))
+            // 先更新任务状态再解除暂停，由 unhold 统一把待执行的任务放入队列
+            se.releaseDeletes(held)
+            se.unhold()
+        } else {
+            se.logger.Info().Msgf("已取消删除 %d 个文件，同步保持暂停", len(held))
+            se.cancelDeletes(held)
+        }
+    }
+}
+
+func (se *SyncEngine) exceedsDeleteLimit(deletes, total int) bool {
+    if se.config.MaxDeletes > 0 && deletes > se.config.MaxDeletes {
+        return true
+    }
+    if se.config.MaxDeletePercent > 0 && total >= minFilesForPercent &&
+        deletes*100 > se.config.MaxDeletePercent*total {
+        return true
+    }
+    return false
+}
+
+// releaseDeletes 把暂缓的删除任务标记为待执行，由调用方负责放入队列
+func (se *SyncEngine) releaseDeletes(tasks []models.Task) {
+    for i := range tasks {
+        tasks[i].Status = "pending"
+        _, err := se.db.Exec("UPDATE tasks SET status = ? WHERE profile_id = ? AND path = ? AND operation = ?",
+            tasks[i].Status, se.profileID, tasks[i].Path, tasks[i].Operation)
+        if err != nil {
+            se.logger.Error().Err(err).Msg("更新任务失败")
+        }
+    }
+}
+
+func (se *SyncEngine) cancelDeletes(tasks []models.Task) {
+    for _, task := range tasks {
+        _, err := se.db.Exec("UPDATE tasks SET status = 'cancelled' WHERE profile_id = ? AND path = ? AND operation = ?",
+            se.profileID, task.Path, task.Operation)
+        if err != nil {
+            se.logger.Error().Err(err).Msg("更新任务失败")
+        }
+    }
+}
+
+func (se *SyncEngine) countFiles() (int, error) {
+    var total int
+    err := se.db.QueryRow("SELECT COUNT(*) FROM files WHERE profile_id = ?", se.profileID).Scan(&total)
+    return total, err
+}
@@ -0,0 +1,111 @@
+package engine
+
+import (
+    "context"
+    "time"
+
+    "WebdavSync/models"
+)
+
+// scheduleCheckInterval 是重新计算计划时段的最长间隔，系统时间被调整后也能及时生效
+const scheduleCheckInterval = time.Minute
+
+// scheduleModified 是计划被修改后 Manager.window 的取值，下次计算时无论时段是否变化都重新应用
+const scheduleModified = -2
+
+// ScheduleStatus 描述当前所处的计划时段
+type ScheduleStatus struct {
+    Rule *models.ScheduleRule // 当前生效的规则，nil 表示不在任何时段内，使用默认限速
+    Next time.Time            // 下一次切换时段的时间，零值表示一周内不会切换
+}
+
+// runSchedule 在时段切换时应用计划，暂停或恢复同步并调整限速
+func (m *Manager) runSchedule(ctx context.Context) {
+    for {
+        m.applySchedule()
+        wait := scheduleCheckInterval
+        if next := m.ScheduleStatus().Next; !next.IsZero() {
+            wait = min(wait, time.Until(next))
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(wait):
+        }
+    }
+}
+
+// applySchedule 按当前时间生效的计划规则设置限速和计划暂停，不在任何时段内时使用全局限速。
+// 只有时段切换或计划被修改时才改变暂停状态
+func (m *Manager) applySchedule() {
+    m.mu.Lock()
+    settings := m.settings
+    window := models.ActiveSchedule(settings.Schedule, time.Now())
+    prev := m.window
+    m.window = window
+    m.mu.Unlock()
+    if window == prev {
+        return
+    }
+    logged := prev != scheduleModified
+
+    upload, download := settings.UploadLimit, settings.DownloadLimit
+    if window >= 0 {
+        rule := settings.Schedule[window]
+        switch rule.Mode {
+        case models.ScheduleLimit:
+            upload, download = rule.Upload, rule.Download
+        case models.ScheduleFull:
+            upload, download = 0, 0
+        }
+        if logged {
+            m.logger.Info().Msgf("进入计划时段 %s（%s）", rule, rule.Mode)
+        }
+    } else if logged {
+        m.logger.Info().Msg("离开计划时段，恢复默认限速")
+    }
+    SetBandwidthLimits(upload*1024, download*1024)
+    paused := window >= 0 && settings.Schedule[window].Mode == models.SchedulePause
+    m.setPaused(func() { m.schedulePaused = paused })
+}
+
+// setPaused 修改手动或计划暂停的状态，两者合并后的结果变化时才暂停或恢复各同步对。
+// 删除保护的暂停由引擎单独保持，不受影响
+func (m *Manager) setPaused(update func()) {
+    m.mu.Lock()
+    before := m.userPaused || m.schedulePaused
+    update()
+    after := m.userPaused || m.schedulePaused
+    m.mu.Unlock()
+    if before == after {
+        return
+    }
+    for _, eng := range m.Engines() {
+        if after {
+            eng.Pause()
+        } else {
+            eng.Resume()
+        }
+    }
+}
+
+// ScheduleStatus 返回当前生效的计划时段和下一次切换的时间
+func (m *Manager) ScheduleStatus() ScheduleStatus {
+    m.mu.Lock()
+    rules := m.settings.Schedule
+    m.mu.Unlock()
+    now := time.Now()
+    var status ScheduleStatus
+    if i := models.ActiveSchedule(rules, now); i >= 0 {
+        status.Rule = &rules[i]
+    }
+    status.Next = models.NextScheduleChange(rules, now)
+    return status
+}
+
+// SchedulePaused 判断当前是否处于计划暂停的时段
+func (m *Manager) SchedulePaused() bool {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.schedulePaused
+}
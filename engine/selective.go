@@ -0,0 +1,79 @@
+package engine
+
+import (
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// isExcluded 判断路径是否位于选择性同步中未勾选的目录下
+func (se *SyncEngine) isExcluded(relPath string) bool {
+    relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+    for _, folder := range se.config.ExcludedFolders {
+        folder = strings.Trim(filepath.ToSlash(folder), "/")
+        if folder != "" && (relPath == folder || strings.HasPrefix(relPath, folder+"/")) {
+            return true
+        }
+    }
+    return false
+}
+
+// ListRemoteFolders 列出云端同步目录下 relDir 中的子目录，供选择性同步界面浏览
+func (se *SyncEngine) ListRemoteFolders(relDir string) ([]string, error) {
+    entries, err := se.client.ReadDir(filepath.Join(se.remoteDir, relDir))
+    if err != nil {
+        return nil, err
+    }
+    var folders []string
+    for _, entry := range entries {
+        if !entry.IsDir() {
+            continue
+        }
+        relPath := filepath.ToSlash(filepath.Join(relDir, entry.Name()))
+        if isInternalPath(relPath) || se.isIgnored(relPath, true) {
+            continue
+        }
+        folders = append(folders, relPath)
+    }
+    sort.Strings(folders)
+    return folders, nil
+}
+
+// NewlyExcluded 返回 folders 中相对当前配置新增的排除目录，且本地仍存在副本
+func (se *SyncEngine) NewlyExcluded(folders []string) []string {
+    var added []string
+    for _, folder := range folders {
+        if se.isExcluded(folder) {
+            continue
+        }
+        if _, err := os.Stat(filepath.Join(se.localDir, folder)); err == nil {
+            added = append(added, folder)
+        }
+    }
+    return added
+}
+
+// RemoveLocalFolders 在用户确认后将取消勾选目录的本地副本移入回收站，并清除其同步记录
+func (se *SyncEngine) RemoveLocalFolders(folders []string) error {
+    for _, folder := range folders {
+        if err := se.moveToTrash(folder); err != nil && !os.IsNotExist(err) {
+            return err
+        }
+        pattern := strings.TrimSuffix(filepath.ToSlash(folder), "/") + "/%"
+        if _, err := se.db.Exec("DELETE FROM files WHERE profile_id = ? AND (path = ? OR path LIKE ?)", se.profileID, folder, pattern); err != nil {
+            return err
+        }
+        if _, err := se.db.Exec("DELETE FROM tasks WHERE profile_id = ? AND (path = ? OR path LIKE ?)", se.profileID, folder, pattern); err != nil {
+            return err
+        }
+        if _, err := se.db.Exec("DELETE FROM hash_cache WHERE profile_id = ? AND (path = ? OR path LIKE ?)", se.profileID, folder, pattern); err != nil {
+            return err
+        }
+        if _, err := se.db.Exec("DELETE FROM block_signatures WHERE profile_id = ? AND (path = ? OR path LIKE ?)", se.profileID, folder, pattern); err != nil {
+            return err
+        }
+        se.logger.Info().Msgf("已移除未勾选目录 %s 的本地副本", folder)
+    }
+    return nil
+}
@@ -0,0 +1,297 @@
+package engine
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/xml"
+    "errors"
+    "io"
+    "io/fs"
+    "net/http"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/studio-b12/gowebdav"
+    "WebdavSync/models"
+)
+
+var (
+    // errSyncUnsupported 表示服务器不支持 RFC 6578 sync-collection REPORT
+    errSyncUnsupported = errors.New("服务器不支持 sync-collection")
+    // errSyncTokenInvalid 表示服务器不再接受保存的同步令牌，需要重新完整获取
+    errSyncTokenInvalid = errors.New("同步令牌已失效")
+)
+
+// syncMultistatus 是 sync-collection REPORT 返回的 multistatus
+type syncMultistatus struct {
+    Responses []syncResponse `xml:"DAV: response"`
+    SyncToken string         `xml:"DAV: sync-token"`
+}
+
+type syncResponse struct {
+    Href      string `xml:"DAV: href"`
+    Status    string `xml:"DAV: status"`
+    Propstats []struct {
+        Status string `xml:"DAV: status"`
+        Prop   struct {
+            LastModified  string `xml:"DAV: getlastmodified"`
+            ContentLength string `xml:"DAV: getcontentlength"`
+            ResourceType  struct {
+                Collection *struct{} `xml:"DAV: collection"`
+            } `xml:"DAV: resourcetype"`
+        } `xml:"DAV: prop"`
+    } `xml:"DAV: propstat"`
+}
+
+// remoteEntry 是 sync-collection 报告中的云端成员，实现 fs.FileInfo 以复用完整列表的比较逻辑
+type remoteEntry struct {
+    name    string
+    size    int64
+    modTime time.Time
+    dir     bool
+}
+
+func (e remoteEntry) Name() string       { return e.name }
+func (e remoteEntry) Size() int64        { return e.size }
+func (e remoteEntry) ModTime() time.Time { return e.modTime }
+func (e remoteEntry) IsDir() bool        { return e.dir }
+func (e remoteEntry) Sys() any           { return nil }
+
+func (e remoteEntry) Mode() fs.FileMode {
+    if e.dir {
+        return fs.ModeDir | 0755
+    }
+    return 0644
+}
+
+// remoteChange 是自上次同步令牌以来云端成员的一次变化
+type remoteChange struct {
+    entry   remoteEntry
+    deleted bool
+}
+
+// pollChanges 使用 sync-collection 获取自上次同步令牌以来的云端变化，返回是否发现变化。
+// ok 为 false 表示服务器不支持，调用方应完整列出同步目录
+func (se *SyncEngine) pollChanges() (changed, ok bool) {
+    if se.syncUnsupported {
+        return false, false
+    }
+    token, err := se.loadSyncToken()
+    if err != nil {
+        se.logger.Error().Err(err).Msg("读取同步令牌失败")
+        return false, true
+    }
+    changes, next, err := se.syncCollection(token)
+    if errors.Is(err, errSyncTokenInvalid) {
+        se.logger.Warn().Msg("同步令牌已失效，重新获取云端完整列表")
+        token = ""
+        changes, next, err = se.syncCollection(token)
+    }
+    if errors.Is(err, errSyncUnsupported) {
+        se.logger.Info().Msg("服务器不支持增量同步，改为完整列出云端目录")
+        se.syncUnsupported = true
+        return false, false
+    }
+    if err != nil {
+        se.logger.Error().Err(err).Msg("轮询云端失败")
+        se.setHealth(classifyError(err), err)
+        return false, true
+    }
+
+    if token == "" {
+        // 没有令牌时服务器返回全部成员，等同于完整列表
+        entries := make([]os.FileInfo, 0, len(changes))
+        for _, change := range changes {
+            if !change.deleted {
+                entries = append(entries, change.entry)
+            }
+        }
+        changed, err = se.compareRemote(entries)
+    } else {
+        changed, err = se.applyRemoteChanges(changes)
+    }
+    if err != nil {
+        se.logger.Error().Err(err).Msg("获取文件列表失败")
+        return false, true
+    }
+    // 处理完成后再保存令牌，失败时下次会重新获取同一批变化
+    if err := se.saveSyncToken(next); err != nil {
+        se.logger.Error().Err(err).Msg("保存同步令牌失败")
+    }
+    return changed, true
+}
+
+// applyRemoteChanges 将增量变化应用到本地记录，只处理已有记录的文件，与完整列表的比较一致
+func (se *SyncEngine) applyRemoteChanges(changes []remoteChange) (changed bool, err error) {
+    localFiles, err := se.getLocalFilesFromDB()
+    if err != nil {
+        return false, err
+    }
+    byPath := make(map[string]models.FileInfo, len(localFiles))
+    for _, lf := range localFiles {
+        byPath[lf.Path] = lf
+    }
+    for _, change := range changes {
+        lf, ok := byPath[change.entry.name]
+        if !ok || se.outOfScope(lf.Path, change.entry.dir) {
+            continue
+        }
+        if change.deleted {
+            changed = se.applyRemoteDeletion(lf) || changed
+        } else {
+            changed = se.applyRemoteFile(lf, change.entry) || changed
+        }
+    }
+    return changed, nil
+}
+
+// syncCollection 发送 sync-collection REPORT，返回自 token 以来的变化和新的同步令牌。
+// 服务器截断结果时使用返回的令牌继续获取剩余部分
+func (se *SyncEngine) syncCollection(token string) ([]remoteChange, string, error) {
+    header := http.Header{
+        "Content-Type": {"application/xml; charset=utf-8"},
+        "Depth":        {"0"},
+    }
+    base := se.collectionPath()
+    var changes []remoteChange
+    for {
+        rs, err := se.conn.Do("REPORT", se.remoteDir, syncCollectionBody(token), header)
+        if err != nil {
+            return nil, "", err
+        }
+        report, err := readSyncReport(rs, se.remoteDir)
+        if err != nil {
+            return nil, "", err
+        }
+        truncated := false
+        for _, response := range report.Responses {
+            name, ok := memberName(response.Href, base)
+            if !ok {
+                continue
+            }
+            if name == "" {
+                // 集合自身返回 507 表示结果被截断
+                truncated = truncated || statusCode(response.Status) == http.StatusInsufficientStorage
+                continue
+            }
+            if change, ok := parseSyncResponse(name, response); ok {
+                changes = append(changes, change)
+            }
+        }
+        if !truncated || report.SyncToken == token {
+            return changes, report.SyncToken, nil
+        }
+        token = report.SyncToken
+    }
+}
+
+// syncCollectionBody 生成 sync-collection REPORT 的请求体，只获取直接子项，与完整列表的范围一致
+func syncCollectionBody(token string) []byte {
+    var b bytes.Buffer
+    b.WriteString(`<?xml version="1.0" encoding="utf-8"?><d:sync-collection xmlns:d="DAV:"><d:sync-token>`)
+    xml.EscapeText(&b, []byte(token))
+    b.WriteString(`</d:sync-token><d:sync-level>1</d:sync-level>` +
+        `<d:prop><d:getlastmodified/><d:getcontentlength/><d:resourcetype/></d:prop></d:sync-collection>`)
+    return b.Bytes()
+}
+
+// readSyncReport 解析 REPORT 响应，区分服务器不支持、令牌失效和其他错误
+func readSyncReport(rs *http.Response, path string) (syncMultistatus, error) {
+    defer rs.Body.Close()
+    var report syncMultistatus
+    switch rs.StatusCode {
+    case http.StatusMultiStatus:
+        if err := xml.NewDecoder(rs.Body).Decode(&report); err != nil {
+            return report, err
+        }
+        if report.SyncToken == "" {
+            // 服务器把 REPORT 当作普通请求处理，没有返回令牌
+            return report, errSyncUnsupported
+        }
+        return report, nil
+    case http.StatusForbidden, http.StatusConflict:
+        data, _ := io.ReadAll(io.LimitReader(rs.Body, 64<<10))
+        if bytes.Contains(data, []byte("valid-sync-token")) {
+            return report, errSyncTokenInvalid
+        }
+        if bytes.Contains(data, []byte("supported-report")) {
+            return report, errSyncUnsupported
+        }
+    case http.StatusBadRequest, http.StatusMethodNotAllowed, http.StatusUnsupportedMediaType, http.StatusNotImplemented:
+        return report, errSyncUnsupported
+    }
+    return report, gowebdav.NewPathError("REPORT", path, rs.StatusCode)
+}
+
+// parseSyncResponse 将报告中的一个成员转换为变化，404 表示成员已删除
+func parseSyncResponse(name string, response syncResponse) (remoteChange, bool) {
+    change := remoteChange{entry: remoteEntry{name: name}}
+    if statusCode(response.Status) == http.StatusNotFound {
+        change.deleted = true
+        return change, true
+    }
+    for _, propstat := range response.Propstats {
+        if statusCode(propstat.Status) != http.StatusOK {
+            continue
+        }
+        prop := propstat.Prop
+        change.entry.dir = prop.ResourceType.Collection != nil
+        change.entry.size, _ = strconv.ParseInt(prop.ContentLength, 10, 64)
+        change.entry.modTime, _ = http.ParseTime(prop.LastModified)
+        return change, true
+    }
+    return change, false
+}
+
+// collectionPath 返回云端同步目录在服务器上的路径（已解码，以 / 结尾），用于解析报告中的 href
+func (se *SyncEngine) collectionPath() string {
+    u, err := url.Parse(gowebdav.PathEscape(gowebdav.Join(se.conn.account.URL, se.remoteDir)))
+    if err != nil {
+        return ""
+    }
+    return strings.TrimSuffix(u.Path, "/") + "/"
+}
+
+// memberName 返回 href 相对于同步目录的名称，集合自身返回空字符串
+func memberName(href, base string) (string, bool) {
+    u, err := url.Parse(href)
+    if err != nil {
+        return "", false
+    }
+    p := strings.TrimSuffix(u.Path, "/") + "/"
+    if !strings.HasPrefix(p, base) {
+        return "", false
+    }
+    return strings.TrimSuffix(strings.TrimPrefix(p, base), "/"), true
+}
+
+// statusCode 从 "HTTP/1.1 404 Not Found" 形式的状态行中取出状态码
+func statusCode(status string) int {
+    fields := strings.Fields(status)
+    if len(fields) < 2 {
+        return 0
+    }
+    code, _ := strconv.Atoi(fields[1])
+    return code
+}
+
+func (se *SyncEngine) loadSyncToken() (string, error) {
+    var token string
+    err := se.db.QueryRow("SELECT value FROM config WHERE profile_id = ? AND key = 'sync_token'", se.profileID).Scan(&token)
+    if err == sql.ErrNoRows {
+        return "", nil
+    }
+    return token, err
+}
+
+func (se *SyncEngine) saveSyncToken(token string) error {
+    if token == "" {
+        _, err := se.db.Exec("DELETE FROM config WHERE profile_id = ? AND key = 'sync_token'", se.profileID)
+        return err
+    }
+    _, err := se.db.Exec("INSERT OR REPLACE INTO config (profile_id, key, value) VALUES (?, 'sync_token', ?)", se.profileID, token)
+    return err
+}
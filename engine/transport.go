@@ -0,0 +1,79 @@
+package engine
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/hex"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+
+    "WebdavSync/models"
+)
+
+// NewTransport 按账户的 TLS 和代理设置创建 HTTP 传输层，引擎对该账户的所有请求都经由它发出
+func NewTransport(account models.Account) (*http.Transport, error) {
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    config := &tls.Config{InsecureSkipVerify: account.Insecure}
+
+    if account.CACert != "" {
+        pem, err := os.ReadFile(account.CACert)
+        if err != nil {
+            return nil, fmt.Errorf("读取 CA 证书失败: %w", err)
+        }
+        // 在系统证书的基础上追加内部 CA，公网证书仍然可用
+        pool, err := x509.SystemCertPool()
+        if err != nil {
+            pool = x509.NewCertPool()
+        }
+        if !pool.AppendCertsFromPEM(pem) {
+            return nil, fmt.Errorf("CA 证书 %s 中没有有效的 PEM 证书", account.CACert)
+        }
+        config.RootCAs = pool
+    }
+
+    if account.ClientCert != "" || account.ClientKey != "" {
+        cert, err := tls.LoadX509KeyPair(account.ClientCert, account.ClientKey)
+        if err != nil {
+            return nil, fmt.Errorf("加载客户端证书失败: %w", err)
+        }
+        config.Certificates = []tls.Certificate{cert}
+    }
+
+    if account.PinSHA256 != "" {
+        pin, err := parseFingerprint(account.PinSHA256)
+        if err != nil {
+            return nil, err
+        }
+        // 即使跳过了证书链校验也会检查指纹，可用于固定自签名证书
+        config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+            if len(rawCerts) == 0 {
+                return fmt.Errorf("服务器未提供证书")
+            }
+            sum := sha256.Sum256(rawCerts[0])
+            if !bytes.Equal(sum[:], pin) {
+                return fmt.Errorf("服务器证书指纹 %s 与固定的指纹不符", hex.EncodeToString(sum[:]))
+            }
+            return nil
+        }
+    }
+
+    transport.TLSClientConfig = config
+    if err := applyProxy(transport, account); err != nil {
+        return nil, err
+    }
+    return transport, nil
+}
+
+// parseFingerprint 解析十六进制的 SHA-256 指纹，允许使用冒号或空格分隔
+func parseFingerprint(fingerprint string) ([]byte, error) {
+    cleaned := strings.NewReplacer(":", "", " ", "").Replace(fingerprint)
+    pin, err := hex.DecodeString(cleaned)
+    if err != nil || len(pin) != sha256.Size {
+        return nil, fmt.Errorf("证书指纹无效：%s", fingerprint)
+    }
+    return pin, nil
+}
@@ -0,0 +1,170 @@
+package engine
+
+import (
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/fsnotify/fsnotify"
+    "WebdavSync/models"
+)
+
+// TrashDirName 是本地同步目录下由引擎管理的回收站目录
+const TrashDirName = ".synctrash"
+
+func (se *SyncEngine) trashDir() string {
+    return filepath.Join(se.localDir, TrashDirName)
+}
+
+// moveToTrash 将本地文件或目录移入回收站并记录原始路径和删除时间
+func (se *SyncEngine) moveToTrash(relPath string) error {
+    localPath := filepath.Join(se.localDir, relPath)
+    fi, err := os.Stat(localPath)
+    if err != nil {
+        return err
+    }
+    size := fi.Size()
+    if fi.IsDir() {
+        size = dirSize(localPath)
+    }
+    now := time.Now()
+    trashPath := filepath.Join(filepath.Dir(relPath), fmt.Sprintf("%d_%s", now.UnixNano(), filepath.Base(relPath)))
+    dst := filepath.Join(se.trashDir(), trashPath)
+    if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+        return err
+    }
+    if err := os.Rename(localPath, dst); err != nil {
+        return err
+    }
+    _, err = se.db.Exec("INSERT INTO trash (profile_id, path, trash_path, deleted_at, size) VALUES (?, ?, ?, ?, ?)",
+        se.profileID, relPath, trashPath, now.Unix(), size)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("保存回收站记录失败")
+    }
+    se.logger.Info().Msgf("本地文件 %s 已移入回收站", relPath)
+    return nil
+}
+
+// dirSize 返回目录中所有文件的总大小
+func dirSize(dir string) int64 {
+    var size int64
+    filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+        if err == nil && d.Type().IsRegular() {
+            if info, err := d.Info(); err == nil {
+                size += info.Size()
+            }
+        }
+        return nil
+    })
+    return size
+}
+
+// TrashEntries 返回回收站中的所有文件，最近删除的排在前面
+func (se *SyncEngine) TrashEntries() ([]models.TrashEntry, error) {
+    rows, err := se.db.Query("SELECT id, profile_id, path, trash_path, deleted_at, size FROM trash WHERE profile_id = ? ORDER BY deleted_at DESC", se.profileID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var entries []models.TrashEntry
+    for rows.Next() {
+        var entry models.TrashEntry
+        if err := rows.Scan(&entry.ID, &entry.ProfileID, &entry.Path, &entry.TrashPath, &entry.DeletedAt, &entry.Size); err != nil {
+            return nil, err
+        }
+        entries = append(entries, entry)
+    }
+    return entries, nil
+}
+
+func (se *SyncEngine) getTrashEntry(id int64) (models.TrashEntry, error) {
+    var entry models.TrashEntry
+    row := se.db.QueryRow("SELECT id, profile_id, path, trash_path, deleted_at, size FROM trash WHERE profile_id = ? AND id = ?", se.profileID, id)
+    err := row.Scan(&entry.ID, &entry.ProfileID, &entry.Path, &entry.TrashPath, &entry.DeletedAt, &entry.Size)
+    return entry, err
+}
+
+// RestoreTrash 将回收站中的文件或目录放回原位置并重新同步到云端
+func (se *SyncEngine) RestoreTrash(id int64) error {
+    entry, err := se.getTrashEntry(id)
+    if err != nil {
+        return err
+    }
+    localPath := filepath.Join(se.localDir, entry.Path)
+    if _, err := os.Stat(localPath); err == nil {
+        return fmt.Errorf("文件 %s 已存在，无法恢复", entry.Path)
+    }
+    if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+        return err
+    }
+    if err := os.Rename(filepath.Join(se.trashDir(), entry.TrashPath), localPath); err != nil {
+        return err
+    }
+    if _, err := se.db.Exec("DELETE FROM trash WHERE id = ?", entry.ID); err != nil {
+        se.logger.Error().Err(err).Msg("删除回收站记录失败")
+    }
+    se.logger.Info().Msgf("已从回收站恢复 %s", entry.Path)
+    // 恢复的目录需要逐个文件重新同步
+    return filepath.WalkDir(localPath, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.Type().IsRegular() {
+            se.handleLocalChange(fsnotify.Event{Name: path, Op: fsnotify.Write})
+        }
+        return nil
+    })
+}
+
+// purgeTrash 定期清理超过保留天数的回收站文件
+func (se *SyncEngine) purgeTrash() {
+    ticker := time.NewTicker(time.Hour)
+    defer ticker.Stop()
+    for {
+        se.purgeExpiredTrash()
+        select {
+        case <-se.ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (se *SyncEngine) purgeExpiredTrash() {
+    if se.config.TrashDays <= 0 {
+        return
+    }
+    cutoff := time.Now().AddDate(0, 0, -se.config.TrashDays).Unix()
+    rows, err := se.db.Query("SELECT id, profile_id, path, trash_path, deleted_at, size FROM trash WHERE profile_id = ? AND deleted_at < ?", se.profileID, cutoff)
+    if err != nil {
+        se.logger.Error().Err(err).Msg("查询回收站失败")
+        return
+    }
+    var expired []models.TrashEntry
+    for rows.Next() {
+        var entry models.TrashEntry
+        if err := rows.Scan(&entry.ID, &entry.ProfileID, &entry.Path, &entry.TrashPath, &entry.DeletedAt, &entry.Size); err != nil {
+            se.logger.Error().Err(err).Msg("查询回收站失败")
+            break
+        }
+        expired = append(expired, entry)
+    }
+    rows.Close()
+
+    for _, entry := range expired {
+        // 取消勾选的目录整体移入回收站，需要连同内容一起删除
+        err := os.RemoveAll(filepath.Join(se.trashDir(), entry.TrashPath))
+        if err != nil {
+            se.logger.Error().Err(err).Msgf("清理回收站文件 %s 失败", entry.Path)
+            continue
+        }
+        if _, err := se.db.Exec("DELETE FROM trash WHERE id = ?", entry.ID); err != nil {
+            se.logger.Error().Err(err).Msg("删除回收站记录失败")
+            continue
+        }
+        se.logger.Info().Msgf("回收站文件 %s 已过期清理", entry.Path)
+    }
+}
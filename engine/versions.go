@@ -0,0 +1,84 @@
+package engine
+
+import (
+    "path/filepath"
+    "time"
+
+    "github.com/studio-b12/gowebdav"
+)
+
+// VersionsDirName 是云端同步目录下保存历史版本的集合
+const VersionsDirName = ".versions"
+
+// versionLayout 是每个历史版本集合的命名格式
+const versionLayout = "20060102-150405"
+
+// archiveRemote 在覆盖或删除云端文件前保留旧版本。
+// keep 为 true 时使用 COPY（之后会被覆盖），否则使用 MOVE（之后会被删除）。
+// 返回 moved 表示文件已被移走，调用方无需再删除。
+func (se *SyncEngine) archiveRemote(relPath string, keep bool) (moved bool, err error) {
+    if !se.config.RemoteVersions {
+        return false, nil
+    }
+    remotePath := filepath.Join(se.remoteDir, relPath)
+    if _, err := se.client.Stat(remotePath); err != nil {
+        if gowebdav.IsErrNotFound(err) {
+            return false, nil
+        }
+        return false, err
+    }
+    versionPath := filepath.Join(se.remoteDir, VersionsDirName, time.Now().Format(versionLayout), relPath)
+    if err := se.client.MkdirAll(filepath.Dir(versionPath), 0755); err != nil {
+        return false, err
+    }
+    if keep {
+        err = se.client.Copy(remotePath, versionPath, true)
+    } else {
+        err = se.client.Rename(remotePath, versionPath, true)
+    }
+    if err != nil {
+        return false, err
+    }
+    se.logger.Info().Msgf("云端文件 %s 的旧版本已保存到 %s", relPath, versionPath)
+    return !keep, nil
+}
+
+// pruneVersions 定期删除超过保留天数的云端历史版本
+func (se *SyncEngine) pruneVersions() {
+    ticker := time.NewTicker(time.Hour)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-se.ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        if !se.config.RemoteVersions || se.config.VersionDays <= 0 || !se.reachable() || se.suspended() {
+            continue
+        }
+        se.pruneExpiredVersions()
+    }
+}
+
+func (se *SyncEngine) pruneExpiredVersions() {
+    versionsDir := filepath.Join(se.remoteDir, VersionsDirName)
+    entries, err := se.client.ReadDir(versionsDir)
+    if err != nil {
+        if !gowebdav.IsErrNotFound(err) {
+            se.logger.Error().Err(err).Msg("读取云端历史版本失败")
+        }
+        return
+    }
+    cutoff := time.Now().AddDate(0, 0, -se.config.VersionDays)
+    for _, entry := range entries {
+        created, err := time.ParseInLocation(versionLayout, entry.Name(), time.Local)
+        if err != nil || !entry.IsDir() || !created.Before(cutoff) {
+            continue
+        }
+        if err := se.client.RemoveAll(filepath.Join(versionsDir, entry.Name())); err != nil {
+            se.logger.Error().Err(err).Msgf("清理云端历史版本 %s 失败", entry.Name())
+            continue
+        }
+        se.logger.Info().Msgf("云端历史版本 %s 已过期清理", entry.Name())
+    }
+}
@@ -3,6 +3,12 @@ package gui
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
@@ -16,7 +22,7 @@ import (
 )
 
 // Run 启动 GUI 和系统托盘
-func Run(eng *engine.SyncEngine, db *db.DB) {
+func Run(mgr *engine.Manager, db *db.DB) {
 	a := app.NewWithID("com.webdavsync")
 	w := a.NewWindow("WebDAV Sync")
 	w.Resize(fyne.NewSize(800, 600))
@@ -24,84 +30,354 @@ func Run(eng *engine.SyncEngine, db *db.DB) {
 
 	// 主界面组件
 	statusLabel := widget.NewLabel("状态：空闲")
+	scheduleLabel := widget.NewLabel("")
+	transferLabel := widget.NewLabel("")
+	refreshSchedule := func() {
+		scheduleLabel.SetText(scheduleText(mgr))
+	}
 	logText := widget.NewMultiLineEntry()
 	logText.SetPlaceHolder("同步日志...")
 	logText.Disable()
 
+	// 同步对列表
+	var profiles []models.Profile
+	var selected models.Profile
+	profileList := widget.NewList(
+		func() int { return len(profiles) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			p := profiles[i]
+			o.(*widget.Label).SetText(fmt.Sprintf("%s  [%s]", p.Name, profileStatus(mgr.Engine(p.ID))))
+		},
+	)
+	profileList.OnSelected = func(i widget.ListItemID) {
+		selected = profiles[i]
+	}
+	reloadProfiles := func() {
+		loaded, err := models.LoadProfiles(db.DB)
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		profiles = loaded
+		profileList.Refresh()
+	}
+	reloadProfiles()
+	profileName := func(id int64) string {
+		for _, p := range profiles {
+			if p.ID == id {
+				return p.Name
+			}
+		}
+		return strconv.FormatInt(id, 10)
+	}
+	// selectedEngine 返回当前选中同步对的引擎，未选中时提示用户
+	selectedEngine := func() *engine.SyncEngine {
+		eng := mgr.Engine(selected.ID)
+		if eng == nil {
+			dialog.ShowInformation("提示", "请先选择一个同步对", w)
+		}
+		return eng
+	}
+
+	addBtn := widget.NewButton("新建同步对", func() {
+		showConfigDialog(w, mgr, db, models.Profile{}, reloadProfiles)
+	})
+
 	configBtn := widget.NewButton("配置", func() {
-		showConfigDialog(w, eng, db)
+		if selectedEngine() != nil {
+			showConfigDialog(w, mgr, db, selected, reloadProfiles)
+		}
 	})
 
+	removeBtn := widget.NewButton("删除同步对", func() {
+		if selectedEngine() == nil {
+			return
+		}
+		profile := selected
+		dialog.ShowConfirm("删除同步对",
+			fmt.Sprintf("确定删除同步对 %s 吗？本地和云端文件不会被删除。", profile.Name),
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := mgr.RemoveProfile(profile.ID); err != nil {
+					dialog.ShowError(err, w)
+					return
+				}
+				selected = models.Profile{}
+				profileList.UnselectAll()
+				reloadProfiles()
+				logText.SetText(logText.Text + fmt.Sprintf("\n已删除同步对 %s", profile.Name))
+			}, w)
+	})
+
+	filesBtn := widget.NewButton("文件列表", func() {
+		if selectedEngine() != nil {
+			showFilesDialog(w, db, selected.ID)
+		}
+	})
+
+	selectiveBtn := widget.NewButton("选择性同步", func() {
+		if eng := selectedEngine(); eng != nil {
+			showSelectiveSyncDialog(w, eng, db, logText)
+		}
+	})
+
+	trashBtn := widget.NewButton("回收站", func() {
+		if eng := selectedEngine(); eng != nil {
+			showTrashDialog(w, eng, logText)
+		}
+	})
+
+	accountsBtn := widget.NewButton("账户", func() {
+		showAccountsDialog(w, mgr, logText)
+	})
+
+	bandwidthBtn := widget.NewButton("限速与计划", func() {
+		showBandwidthDialog(w, mgr, logText, func() {
+			refreshSchedule()
+			profileList.Refresh()
+		})
+	})
+
+	// 取消解锁对话框后仍可重新解锁，解锁前不启动同步
+	unlockBtn := widget.NewButton("解锁凭据", nil)
+	unlockBtn.Hide()
+
 	var pauseBtn *widget.Button
 	pauseBtn = widget.NewButton("暂停同步", func() {
-		if eng.IsPaused() {
-			eng.Resume()
+		if mgr.IsPaused() {
+			mgr.Resume()
 			pauseBtn.SetText("暂停同步")
 			statusLabel.SetText("状态：运行中")
-			updateTrayMenu(a, eng, w, statusLabel, pauseBtn)
+			updateTrayMenu(a, mgr, w, statusLabel, pauseBtn)
 			logText.SetText(logText.Text + "\n同步已恢复")
 		} else {
-			eng.Pause()
+			mgr.Pause()
 			pauseBtn.SetText("恢复同步")
 			statusLabel.SetText("状态：已暂停")
-			updateTrayMenu(a, eng, w, statusLabel, pauseBtn)
+			updateTrayMenu(a, mgr, w, statusLabel, pauseBtn)
 			logText.SetText(logText.Text + "\n同步已暂停")
 		}
+		profileList.Refresh()
 	})
 
 	// 主布局
-	content := container.NewVBox(
-		statusLabel,
-		configBtn,
-		pauseBtn,
-		widget.NewLabel("同步日志："),
-		container.NewVScroll(logText),
+	content := container.NewBorder(
+		container.NewVBox(
+			statusLabel,
+			scheduleLabel,
+			transferLabel,
+			container.NewHBox(addBtn, configBtn, removeBtn, accountsBtn, pauseBtn, unlockBtn),
+			container.NewHBox(filesBtn, selectiveBtn, trashBtn, bandwidthBtn),
+		),
+		nil, nil, nil,
+		container.NewVSplit(
+			profileList,
+			container.NewBorder(widget.NewLabel("同步日志："), nil, nil, nil, container.NewVScroll(logText)),
+		),
 	)
 	w.SetContent(content)
 
 	// 设置系统托盘
-	setupTray(a, eng, w, statusLabel, pauseBtn)
+	setupTray(a, mgr, w, statusLabel, pauseBtn)
 
-	// 启动同步引擎
+	// 启动所有同步对
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	start := func() {
+		unlockBtn.Hide()
+		statusLabel.SetText("状态：空闲")
+		go func() {
+			if err := mgr.Start(ctx); err != nil {
+				dialog.ShowError(err, w)
+				logText.SetText(logText.Text + "\n启动同步引擎失败: " + err.Error())
+			} else {
+				logText.SetText(logText.Text + "\n同步引擎已启动")
+			}
+			refreshSchedule()
+			profileList.Refresh()
+		}()
+	}
+	// 凭据未解锁前不启动同步，避免使用无法读取的密码连接服务器
+	locked, err := models.InitVault(db.DB)
+	if err != nil {
+		dialog.ShowError(err, w)
+	}
+	unlockBtn.OnTapped = func() {
+		showUnlockDialog(w, db, start)
+	}
+	if locked {
+		statusLabel.SetText("状态：凭据已锁定")
+		unlockBtn.Show()
+		showUnlockDialog(w, db, start)
+	} else {
+		start()
+	}
+
+	// 处理冲突
 	go func() {
-		if err := eng.Start(ctx); err != nil {
-			dialog.ShowError(err, w)
-			logText.SetText(logText.Text + "\n启动同步引擎失败: " + err.Error())
-		} else {
-			logText.SetText(logText.Text + "\n同步引擎已启动")
+		for conflict := range mgr.Conflicts() {
+			showConflictDialog(w, profileName(conflict.ProfileID), conflict, logText)
 		}
 	}()
 
-	// 处理冲突
+	// 定期刷新各同步对的状态
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			refreshSchedule()
+			profileList.Refresh()
+		}
+	}()
+
+	// 显示进行中的传输
+	go func() {
+		type transferKey struct{ profile, task int64 }
+		progress, unsubscribe := mgr.SubscribeProgress()
+		defer unsubscribe()
+		active := make(map[transferKey]engine.Progress)
+		for p := range progress {
+			key := transferKey{p.ProfileID, p.TaskID}
+			if p.Finished {
+				delete(active, key)
+			} else {
+				active[key] = p
+			}
+			lines := make([]string, 0, len(active))
+			for _, p := range active {
+				lines = append(lines, transferText(p))
+			}
+			sort.Strings(lines)
+			transferLabel.SetText(strings.Join(lines, "\n"))
+		}
+	}()
+
+	// 处理批量删除确认
 	go func() {
-		for conflict := range eng.Conflicts() {
-			showConflictDialog(w, conflict, logText)
+		for confirm := range mgr.DeleteConfirmations() {
+			profileList.Refresh()
+			showDeleteConfirmDialog(w, profileName(confirm.ProfileID), confirm, logText, func(bool) {
+				profileList.Refresh()
+			})
 		}
 	}()
 
 	w.ShowAndRun()
 }
 
+// profileStatus 返回同步对的状态文字
+func profileStatus(eng *engine.SyncEngine) string {
+	if eng == nil {
+		return "未启动"
+	}
+	if err := eng.RootError(); err != nil {
+		return "错误 - " + err.Error()
+	}
+	if eng.Held() {
+		return "已暂停 - 批量删除等待确认或已取消"
+	}
+	if eng.IsPaused() {
+		return "已暂停"
+	}
+	if state, _ := eng.Health(); state != engine.HealthOnline {
+		return healthText[state]
+	}
+	return "运行中"
+}
+
+// scheduleText 返回当前计划时段和下一次切换时间的说明，未配置计划时返回空字符串
+func scheduleText(mgr *engine.Manager) string {
+	status := mgr.ScheduleStatus()
+	if status.Rule == nil && status.Next.IsZero() {
+		return ""
+	}
+	text := "计划：默认限速"
+	if rule := status.Rule; rule != nil {
+		switch rule.Mode {
+		case models.SchedulePause:
+			text = fmt.Sprintf("计划：%s 暂停同步", rule)
+		case models.ScheduleLimit:
+			text = fmt.Sprintf("计划：%s 限速（上传 %s，下载 %s）", rule, rateText(rule.Upload), rateText(rule.Download))
+		case models.ScheduleFull:
+			text = fmt.Sprintf("计划：%s 全速", rule)
+		}
+	}
+	if !status.Next.IsZero() {
+		text += "，下次切换 " + status.Next.Format("01-02 15:04")
+	}
+	return text
+}
+
+func rateText(kb int64) string {
+	if kb == 0 {
+		return "不限"
+	}
+	return fmt.Sprintf("%d KB/s", kb)
+}
+
+// transferText 返回一次传输的进度说明，例如“上传 a.zip 45%（1.2 MB/s，剩余 30s）”
+func transferText(p engine.Progress) string {
+	op := "下载"
+	if p.Operation == "upload" {
+		op = "上传"
+	}
+	text := fmt.Sprintf("%s %s %s", op, p.Path, byteText(float64(p.Done)))
+	if p.Total > 0 {
+		text = fmt.Sprintf("%s %s %d%%", op, p.Path, p.Done*100/p.Total)
+	}
+	if p.Rate > 0 {
+		text += fmt.Sprintf("（%s/s", byteText(p.Rate))
+		if p.ETA >= 0 {
+			text += "，剩余 " + p.ETA.Round(time.Second).String()
+		}
+		text += "）"
+	}
+	return text
+}
+
+// byteText 将字节数格式化为便于阅读的形式
+func byteText(n float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// healthText 是各连接状态在界面上的说明
+var healthText = map[engine.HealthState]string{
+	engine.HealthOffline:     "离线 - 无法连接服务器",
+	engine.HealthAuthFailed:  "错误 - 认证失败，请检查账户凭据",
+	engine.HealthServerError: "错误 - 服务器内部错误",
+	engine.HealthThrottled:   "等待 - 服务器繁忙，稍后自动重试",
+	engine.HealthNotFound:    "错误 - 云端目录不存在",
+	engine.HealthNoSpace:     "警告 - 云端空间不足",
+	engine.HealthForbidden:   "警告 - 没有云端目录的访问权限",
+}
+
 // setupTray 设置系统托盘 (使用 Fyne 内置实现)
-func setupTray(a fyne.App, eng *engine.SyncEngine, w fyne.Window, statusLabel *widget.Label, pauseBtn *widget.Button) {
+func setupTray(a fyne.App, mgr *engine.Manager, w fyne.Window, statusLabel *widget.Label, pauseBtn *widget.Button) {
 	if desk, ok := a.(desktop.App); ok {
 		m := fyne.NewMenu("WebDAV Sync",
 			fyne.NewMenuItem("显示主窗口", func() {
 				w.Show()
 			}),
 			fyne.NewMenuItem("暂停/恢复同步", func() {
-				if eng.IsPaused() {
-					eng.Resume()
+				if mgr.IsPaused() {
+					mgr.Resume()
 					pauseBtn.SetText("暂停同步")
 					statusLabel.SetText("状态：运行中")
 				} else {
-					eng.Pause()
+					mgr.Pause()
 					pauseBtn.SetText("恢复同步")
 					statusLabel.SetText("状态：已暂停")
 				}
-				updateTrayMenu(a, eng, w, statusLabel, pauseBtn)
+				updateTrayMenu(a, mgr, w, statusLabel, pauseBtn)
 			}),
 			fyne.NewMenuItemSeparator(),
 			fyne.NewMenuItem("退出", func() {
@@ -114,10 +390,10 @@ func setupTray(a fyne.App, eng *engine.SyncEngine, w fyne.Window, statusLabel *w
 }
 
 // updateTrayMenu 更新托盘菜单状态
-func updateTrayMenu(a fyne.App, eng *engine.SyncEngine, w fyne.Window, statusLabel *widget.Label, pauseBtn *widget.Button) {
+func updateTrayMenu(a fyne.App, mgr *engine.Manager, w fyne.Window, statusLabel *widget.Label, pauseBtn *widget.Button) {
 	if desk, ok := a.(desktop.App); ok {
 		var pauseText string
-		if eng.IsPaused() {
+		if mgr.IsPaused() {
 			pauseText = "恢复同步"
 		} else {
 			pauseText = "暂停同步"
@@ -128,16 +404,16 @@ func updateTrayMenu(a fyne.App, eng *engine.SyncEngine, w fyne.Window, statusLab
 				w.Show()
 			}),
 			fyne.NewMenuItem(pauseText, func() {
-				if eng.IsPaused() {
-					eng.Resume()
+				if mgr.IsPaused() {
+					mgr.Resume()
 					pauseBtn.SetText("暂停同步")
 					statusLabel.SetText("状态：运行中")
 				} else {
-					eng.Pause()
+					mgr.Pause()
 					pauseBtn.SetText("恢复同步")
 					statusLabel.SetText("状态：已暂停")
 				}
-				updateTrayMenu(a, eng, w, statusLabel, pauseBtn)
+				updateTrayMenu(a, mgr, w, statusLabel, pauseBtn)
 			}),
 			fyne.NewMenuItemSeparator(),
 			fyne.NewMenuItem("退出", func() {
@@ -148,48 +424,165 @@ func updateTrayMenu(a fyne.App, eng *engine.SyncEngine, w fyne.Window, statusLab
 	}
 }
 
-// showConfigDialog 显示配置对话框
-func showConfigDialog(w fyne.Window, eng *engine.SyncEngine, db *db.DB) {
-	cfg, err := models.Load(db.DB)
+// showConfigDialog 显示同步对配置对话框，profile.ID 为 0 时新建同步对
+func showConfigDialog(w fyne.Window, mgr *engine.Manager, db *db.DB, profile models.Profile, onSaved func()) {
+	cfg := models.DefaultConfig()
+	if profile.ID != 0 {
+		var err error
+		cfg, err = models.Load(db.DB, profile.ID)
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+	}
+
+	accounts, err := mgr.Accounts()
 	if err != nil {
 		dialog.ShowError(err, w)
 		return
 	}
+	if len(accounts) == 0 {
+		dialog.ShowInformation("提示", "请先在“账户”中添加 WebDAV 账户", w)
+		return
+	}
 
-	urlEntry := widget.NewEntry()
-	urlEntry.SetText(cfg.URL)
-	userEntry := widget.NewEntry()
-	userEntry.SetText(cfg.User)
-	passEntry := widget.NewPasswordEntry()
-	passEntry.SetText(cfg.Pass)
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(profile.Name)
+	accountNames := make([]string, len(accounts))
+	for i, account := range accounts {
+		accountNames[i] = account.Name
+	}
+	accountSelect := widget.NewSelect(accountNames, func(s string) {})
+	accountSelect.SetSelectedIndex(0)
+	for i, account := range accounts {
+		if account.ID == cfg.AccountID {
+			accountSelect.SetSelectedIndex(i)
+		}
+	}
 	localDirEntry := widget.NewEntry()
 	localDirEntry.SetText(cfg.LocalDir)
 	remoteDirEntry := widget.NewEntry()
 	remoteDirEntry.SetText(cfg.RemoteDir)
 	modeSelect := widget.NewSelect([]string{"bidirectional", "source-to-target", "target-to-source"}, func(s string) {})
 	modeSelect.SetSelected(cfg.Mode)
+	trashDaysEntry := widget.NewEntry()
+	trashDaysEntry.SetText(strconv.Itoa(cfg.TrashDays))
+	versionsCheck := widget.NewCheck("覆盖或删除前保留云端旧版本", func(bool) {})
+	versionsCheck.SetChecked(cfg.RemoteVersions)
+	versionDaysEntry := widget.NewEntry()
+	versionDaysEntry.SetText(strconv.Itoa(cfg.VersionDays))
+	maxDeletesEntry := widget.NewEntry()
+	maxDeletesEntry.SetText(strconv.Itoa(cfg.MaxDeletes))
+	maxDeletePercentEntry := widget.NewEntry()
+	maxDeletePercentEntry.SetText(strconv.Itoa(cfg.MaxDeletePercent))
+	pollIntervalEntry := widget.NewEntry()
+	pollIntervalEntry.SetText(strconv.Itoa(cfg.PollInterval))
+	maxPollIntervalEntry := widget.NewEntry()
+	maxPollIntervalEntry.SetText(strconv.Itoa(cfg.MaxPollInterval))
+	pushCheck := widget.NewCheck("使用 Nextcloud 推送通知（notify_push）", func(bool) {})
+	pushCheck.SetChecked(cfg.Push)
+	rescanIntervalEntry := widget.NewEntry()
+	rescanIntervalEntry.SetText(strconv.Itoa(cfg.RescanInterval))
+	hashSelect := widget.NewSelect(models.HashAlgorithms, func(string) {})
+	hashSelect.SetSelected(cfg.HashAlgorithm)
+	ignoreEntry := widget.NewMultiLineEntry()
+	ignoreEntry.SetPlaceHolder("每行一条，语法同 .gitignore")
+	ignoreEntry.SetText(cfg.IgnorePatterns)
+	filterEntry := widget.NewMultiLineEntry()
+	filterEntry.SetPlaceHolder("例如：max_size=2G\n/reports ext=pdf,docx\nmax_age=365")
+	filterEntry.SetText(models.FormatFilterRules(cfg.Filters))
 
 	form := &widget.Form{
 		Items: []*widget.FormItem{
-			{Text: "WebDAV URL", Widget: urlEntry},
-			{Text: "用户名", Widget: userEntry},
-			{Text: "密码", Widget: passEntry},
+			{Text: "名称", Widget: nameEntry},
+			{Text: "账户", Widget: accountSelect},
 			{Text: "本地目录", Widget: localDirEntry},
 			{Text: "云端目录", Widget: remoteDirEntry},
 			{Text: "同步模式", Widget: modeSelect},
+			{Text: "回收站保留天数", Widget: trashDaysEntry},
+			{Text: "云端版本", Widget: versionsCheck},
+			{Text: "版本保留天数", Widget: versionDaysEntry},
+			{Text: "删除确认阈值（个）", Widget: maxDeletesEntry},
+			{Text: "删除确认阈值（%）", Widget: maxDeletePercentEntry},
+			{Text: "轮询间隔（秒）", Widget: pollIntervalEntry},
+			{Text: "最长轮询间隔（秒）", Widget: maxPollIntervalEntry},
+			{Text: "推送", Widget: pushCheck},
+			{Text: "本地重新扫描间隔（分钟）", Widget: rescanIntervalEntry},
+			{Text: "哈希算法", Widget: hashSelect},
+			{Text: "忽略规则", Widget: ignoreEntry},
+			{Text: "过滤规则", Widget: filterEntry},
 		},
 		OnSubmit: func() {
-			cfg.URL = urlEntry.Text
-			cfg.User = userEntry.Text
-			cfg.Pass = passEntry.Text
+			if nameEntry.Text == "" {
+				dialog.ShowError(fmt.Errorf("名称不能为空"), w)
+				return
+			}
+			cfg.AccountID = accounts[accountSelect.SelectedIndex()].ID
 			cfg.LocalDir = localDirEntry.Text
 			cfg.RemoteDir = remoteDirEntry.Text
 			cfg.Mode = modeSelect.Selected
-			if err := models.Save(db.DB, cfg); err != nil {
+			trashDays, err := strconv.Atoi(trashDaysEntry.Text)
+			if err != nil || trashDays < 0 {
+				dialog.ShowError(fmt.Errorf("回收站保留天数无效：%s", trashDaysEntry.Text), w)
+				return
+			}
+			cfg.TrashDays = trashDays
+			versionDays, err := strconv.Atoi(versionDaysEntry.Text)
+			if err != nil || versionDays < 0 {
+				dialog.ShowError(fmt.Errorf("版本保留天数无效：%s", versionDaysEntry.Text), w)
+				return
+			}
+			cfg.RemoteVersions = versionsCheck.Checked
+			cfg.VersionDays = versionDays
+			maxDeletes, err := strconv.Atoi(maxDeletesEntry.Text)
+			if err != nil || maxDeletes < 0 {
+				dialog.ShowError(fmt.Errorf("删除确认阈值无效：%s", maxDeletesEntry.Text), w)
+				return
+			}
+			maxDeletePercent, err := strconv.Atoi(maxDeletePercentEntry.Text)
+			if err != nil || maxDeletePercent < 0 || maxDeletePercent > 100 {
+				dialog.ShowError(fmt.Errorf("删除确认百分比无效：%s", maxDeletePercentEntry.Text), w)
+				return
+			}
+			cfg.MaxDeletes = maxDeletes
+			cfg.MaxDeletePercent = maxDeletePercent
+			pollInterval, err := strconv.Atoi(pollIntervalEntry.Text)
+			if err != nil || pollInterval < 1 {
+				dialog.ShowError(fmt.Errorf("轮询间隔无效：%s", pollIntervalEntry.Text), w)
+				return
+			}
+			maxPollInterval, err := strconv.Atoi(maxPollIntervalEntry.Text)
+			if err != nil || maxPollInterval < pollInterval {
+				dialog.ShowError(fmt.Errorf("最长轮询间隔无效，不能小于轮询间隔：%s", maxPollIntervalEntry.Text), w)
+				return
+			}
+			cfg.PollInterval = pollInterval
+			cfg.MaxPollInterval = maxPollInterval
+			cfg.Push = pushCheck.Checked
+			rescanInterval, err := strconv.Atoi(rescanIntervalEntry.Text)
+			if err != nil || rescanInterval < 0 {
+				dialog.ShowError(fmt.Errorf("本地重新扫描间隔无效：%s", rescanIntervalEntry.Text), w)
+				return
+			}
+			cfg.RescanInterval = rescanInterval
+			cfg.HashAlgorithm = hashSelect.Selected
+			cfg.IgnorePatterns = ignoreEntry.Text
+			filters, err := models.ParseFilterRules(filterEntry.Text)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("过滤规则无效：%v", err), w)
+				return
+			}
+			cfg.Filters = filters
+			if profile.ID == 0 {
+				_, err = mgr.AddProfile(nameEntry.Text, cfg)
+			} else {
+				err = mgr.UpdateProfile(profile.ID, nameEntry.Text, cfg)
+			}
+			if err != nil {
 				dialog.ShowError(err, w)
 				return
 			}
-			eng.UpdateConfig(cfg)
+			onSaved()
 			dialog.ShowInformation("成功", "配置已保存", w)
 		},
 	}
@@ -203,13 +596,366 @@ func showConfigDialog(w fyne.Window, eng *engine.SyncEngine, db *db.DB) {
 		}, w)
 }
 
+// showUnlockDialog 要求输入主密码解锁凭据，首次使用时设置主密码
+func showUnlockDialog(w fyne.Window, db *db.DB, onUnlocked func()) {
+	exists, err := models.HasPassphrase(db.DB)
+	if err != nil {
+		dialog.ShowError(err, w)
+		return
+	}
+	title := "解锁凭据"
+	passEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+	items := []*widget.FormItem{{Text: "主密码", Widget: passEntry}}
+	if !exists {
+		title = "设置主密码"
+		items = append(items, &widget.FormItem{Text: "确认主密码", Widget: confirmEntry})
+	}
+
+	dialog.ShowForm(title, "确定", "取消", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		if !exists && (passEntry.Text == "" || passEntry.Text != confirmEntry.Text) {
+			dialog.ShowError(fmt.Errorf("两次输入的主密码不一致或为空"), w)
+			showUnlockDialog(w, db, onUnlocked)
+			return
+		}
+		if err := models.Unlock(db.DB, passEntry.Text); err != nil {
+			dialog.ShowError(err, w)
+			showUnlockDialog(w, db, onUnlocked)
+			return
+		}
+		onUnlocked()
+	}, w)
+}
+
+// showBandwidthDialog 设置所有同步对共享的上传和下载限速以及按时段的同步计划，保存后对进行中的传输立即生效
+func showBandwidthDialog(w fyne.Window, mgr *engine.Manager, logText *widget.Entry, onSaved func()) {
+	settings, err := mgr.Settings()
+	if err != nil {
+		dialog.ShowError(err, w)
+		return
+	}
+	uploadEntry := widget.NewEntry()
+	uploadEntry.SetText(strconv.FormatInt(settings.UploadLimit, 10))
+	downloadEntry := widget.NewEntry()
+	downloadEntry.SetText(strconv.FormatInt(settings.DownloadLimit, 10))
+	scheduleEntry := widget.NewMultiLineEntry()
+	scheduleEntry.SetPlaceHolder("例如：mon-fri 09:00-18:00 limit up=200 down=1000\n* 00:00-06:00 full\nsat,sun 12:00-13:00 pause")
+	scheduleEntry.SetText(models.FormatSchedule(settings.Schedule))
+	items := []*widget.FormItem{
+		{Text: "上传限速（KB/s）", Widget: uploadEntry, HintText: "0 表示不限速"},
+		{Text: "下载限速（KB/s）", Widget: downloadEntry, HintText: "0 表示不限速"},
+		{Text: "同步计划", Widget: scheduleEntry, HintText: "每行一个时段，不在任何时段内时使用上面的限速"},
+	}
+
+	dialog.ShowForm("限速与计划", "保存", "取消", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		upload, err := strconv.ParseInt(uploadEntry.Text, 10, 64)
+		if err != nil || upload < 0 {
+			dialog.ShowError(fmt.Errorf("上传限速无效：%s", uploadEntry.Text), w)
+			return
+		}
+		download, err := strconv.ParseInt(downloadEntry.Text, 10, 64)
+		if err != nil || download < 0 {
+			dialog.ShowError(fmt.Errorf("下载限速无效：%s", downloadEntry.Text), w)
+			return
+		}
+		schedule, err := models.ParseSchedule(scheduleEntry.Text)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("同步计划无效：%v", err), w)
+			return
+		}
+		settings.UploadLimit, settings.DownloadLimit = upload, download
+		settings.Schedule = schedule
+		if err := mgr.SaveSettings(settings); err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		logText.SetText(logText.Text + fmt.Sprintf("\n限速已更新：上传 %d KB/s，下载 %d KB/s，计划 %d 条", upload, download, len(schedule)))
+		onSaved()
+	}, w)
+}
+
+// showAccountsDialog 显示账户列表，可新建、编辑和删除账户
+func showAccountsDialog(w fyne.Window, mgr *engine.Manager, logText *widget.Entry) {
+	list := container.NewVBox()
+	var reload func()
+	reload = func() {
+		accounts, err := mgr.Accounts()
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		list.RemoveAll()
+		for _, account := range accounts {
+			account := account
+			list.Add(container.NewBorder(nil, nil, nil,
+				container.NewHBox(
+					widget.NewButton("编辑", func() {
+						showAccountDialog(w, mgr, account, logText, reload)
+					}),
+					widget.NewButton("删除", func() {
+						if err := mgr.RemoveAccount(account.ID); err != nil {
+							dialog.ShowError(err, w)
+							return
+						}
+						logText.SetText(logText.Text + fmt.Sprintf("\n已删除账户 %s", account.Name))
+						reload()
+					}),
+				),
+				widget.NewLabel(fmt.Sprintf("%s（%s）", account.Name, account.URL)),
+			))
+		}
+	}
+	reload()
+
+	addBtn := widget.NewButton("新建账户", func() {
+		showAccountDialog(w, mgr, models.Account{}, logText, reload)
+	})
+	scroll := container.NewVScroll(list)
+	scroll.SetMinSize(fyne.NewSize(500, 300))
+	dialog.ShowCustom("账户", "关闭", container.NewBorder(nil, addBtn, nil, nil, scroll), w)
+}
+
+// showAccountDialog 显示账户编辑对话框，保存后凭据会应用到所有使用该账户的同步对
+func showAccountDialog(w fyne.Window, mgr *engine.Manager, account models.Account, logText *widget.Entry, onSaved func()) {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(account.Name)
+	urlEntry := widget.NewEntry()
+	urlEntry.SetText(account.URL)
+	userEntry := widget.NewEntry()
+	userEntry.SetText(account.User)
+	passEntry := widget.NewPasswordEntry()
+	passEntry.SetText(account.Pass)
+	tokenEntry := widget.NewPasswordEntry()
+	tokenEntry.SetText(account.Token)
+	tokenURLEntry := widget.NewEntry()
+	tokenURLEntry.SetText(account.TokenURL)
+	clientIDEntry := widget.NewEntry()
+	clientIDEntry.SetText(account.ClientID)
+	clientSecretEntry := widget.NewPasswordEntry()
+	clientSecretEntry.SetText(account.ClientSecret)
+	caCertEntry := widget.NewEntry()
+	caCertEntry.SetPlaceHolder("PEM 文件路径，留空使用系统证书")
+	caCertEntry.SetText(account.CACert)
+	clientCertEntry := widget.NewEntry()
+	clientCertEntry.SetPlaceHolder("PEM 文件路径")
+	clientCertEntry.SetText(account.ClientCert)
+	clientKeyEntry := widget.NewEntry()
+	clientKeyEntry.SetPlaceHolder("PEM 文件路径")
+	clientKeyEntry.SetText(account.ClientKey)
+	pinEntry := widget.NewEntry()
+	pinEntry.SetPlaceHolder("SHA-256 指纹，例如 AB:CD:...")
+	pinEntry.SetText(account.PinSHA256)
+	var insecureCheck *widget.Check
+	insecureCheck = widget.NewCheck("跳过证书校验（不安全）", func(checked bool) {
+		if !checked {
+			return
+		}
+		dialog.ShowConfirm("警告", "跳过证书校验后，任何人都可以冒充服务器窃取密码和文件。\n建议改用自定义 CA 或证书指纹。确定继续吗？", func(ok bool) {
+			if !ok {
+				insecureCheck.SetChecked(false)
+			}
+		}, w)
+	})
+	insecureCheck.Checked = account.Insecure
+	tlsForm := widget.NewForm(
+		widget.NewFormItem("CA 证书", caCertEntry),
+		widget.NewFormItem("客户端证书", clientCertEntry),
+		widget.NewFormItem("客户端私钥", clientKeyEntry),
+		widget.NewFormItem("证书指纹", pinEntry),
+		widget.NewFormItem("", insecureCheck),
+	)
+	proxyURLEntry := widget.NewEntry()
+	proxyURLEntry.SetPlaceHolder("http://proxy.example.com:3128")
+	proxyURLEntry.SetText(account.ProxyURL)
+	proxyUserEntry := widget.NewEntry()
+	proxyUserEntry.SetText(account.ProxyUser)
+	proxyPassEntry := widget.NewPasswordEntry()
+	proxyPassEntry.SetText(account.ProxyPass)
+	proxyModes := []string{"system", "manual", "none"}
+	proxyLabels := []string{"系统环境变量", "手动设置", "不使用代理"}
+	proxySelect := widget.NewSelect(proxyLabels, func(label string) {
+		manual := label == proxyLabels[1]
+		for _, entry := range []*widget.Entry{proxyURLEntry, proxyUserEntry, proxyPassEntry} {
+			if manual {
+				entry.Enable()
+			} else {
+				entry.Disable()
+			}
+		}
+	})
+	proxySelect.SetSelectedIndex(0)
+	for i, mode := range proxyModes {
+		if mode == account.ProxyMode {
+			proxySelect.SetSelectedIndex(i)
+		}
+	}
+	proxyForm := widget.NewForm(
+		widget.NewFormItem("代理方式", proxySelect),
+		widget.NewFormItem("代理地址", proxyURLEntry),
+		widget.NewFormItem("代理用户名", proxyUserEntry),
+		widget.NewFormItem("代理密码", proxyPassEntry),
+	)
+	// applyTransport 将对话框中的 TLS 和代理设置写入账户
+	applyTransport := func(a *models.Account) {
+		a.CACert = caCertEntry.Text
+		a.ClientCert = clientCertEntry.Text
+		a.ClientKey = clientKeyEntry.Text
+		a.PinSHA256 = pinEntry.Text
+		a.Insecure = insecureCheck.Checked
+		a.ProxyMode = proxyModes[proxySelect.SelectedIndex()]
+		a.ProxyURL = proxyURLEntry.Text
+		a.ProxyUser = proxyUserEntry.Text
+		a.ProxyPass = proxyPassEntry.Text
+	}
+
+	userItem := &widget.FormItem{Text: "用户名", Widget: userEntry}
+	passItem := &widget.FormItem{Text: "密码", Widget: passEntry, HintText: "Nextcloud 请使用应用密码"}
+	tokenItem := &widget.FormItem{Text: "令牌", Widget: tokenEntry}
+	tokenURLItem := &widget.FormItem{Text: "令牌端点", Widget: tokenURLEntry}
+	clientIDItem := &widget.FormItem{Text: "客户端 ID", Widget: clientIDEntry}
+	clientSecretItem := &widget.FormItem{Text: "客户端密钥", Widget: clientSecretEntry}
+
+	form := &widget.Form{}
+	// 按认证方式只显示需要填写的字段
+	authSelect := widget.NewSelect([]string{"basic", "digest", "bearer", "oauth2"}, func(authType string) {
+		form.Items = form.Items[:3]
+		switch authType {
+		case "bearer":
+			tokenItem.Text = "Bearer 令牌"
+			form.Items = append(form.Items, tokenItem)
+		case "oauth2":
+			tokenItem.Text = "刷新令牌"
+			form.Items = append(form.Items, tokenURLItem, clientIDItem, clientSecretItem, tokenItem)
+		default:
+			form.Items = append(form.Items, userItem, passItem)
+		}
+		form.Refresh()
+	})
+	form.Items = []*widget.FormItem{
+		{Text: "名称", Widget: nameEntry},
+		{Text: "WebDAV URL", Widget: urlEntry},
+		{Text: "认证方式", Widget: authSelect},
+	}
+	if account.AuthType == "" {
+		account.AuthType = "basic"
+	}
+	authSelect.SetSelected(account.AuthType)
+	saved := false
+	form.OnSubmit = func() {
+		if nameEntry.Text == "" || urlEntry.Text == "" {
+			dialog.ShowError(fmt.Errorf("名称和 WebDAV URL 不能为空"), w)
+			return
+		}
+		if authSelect.Selected == "oauth2" && (tokenURLEntry.Text == "" || tokenEntry.Text == "") {
+			dialog.ShowError(fmt.Errorf("OAuth2 需要填写令牌端点和刷新令牌"), w)
+			return
+		}
+		account.Name = nameEntry.Text
+		account.URL = urlEntry.Text
+		account.AuthType = authSelect.Selected
+		account.User = userEntry.Text
+		account.Pass = passEntry.Text
+		account.Token = tokenEntry.Text
+		account.TokenURL = tokenURLEntry.Text
+		account.ClientID = clientIDEntry.Text
+		account.ClientSecret = clientSecretEntry.Text
+		applyTransport(&account)
+		id, err := mgr.SaveAccount(account)
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		account.ID = id
+		saved = true
+		logText.SetText(logText.Text + fmt.Sprintf("\n账户 %s 已保存", account.Name))
+		onSaved()
+	}
+
+	var d dialog.Dialog
+	// 通过 Nextcloud Login Flow v2 在浏览器中授权，自动获取并保存应用密码
+	loginBtn := widget.NewButton("使用 Nextcloud 登录", func() {
+		server := urlEntry.Text
+		if i := strings.Index(server, "/remote.php"); i >= 0 {
+			server = server[:i]
+		}
+		if server == "" {
+			dialog.ShowError(fmt.Errorf("请先在 WebDAV URL 中填写 Nextcloud 服务器地址"), w)
+			return
+		}
+		var transportAccount models.Account
+		applyTransport(&transportAccount)
+		transport, err := engine.NewTransport(transportAccount)
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Minute)
+		go func() {
+			defer cancel()
+			flow, err := engine.StartLoginFlow(ctx, server, transport)
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			loginURL, err := url.Parse(flow.LoginURL)
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			if err := fyne.CurrentApp().OpenURL(loginURL); err != nil {
+				logText.SetText(logText.Text + "\n无法打开浏览器，请手动访问: " + flow.LoginURL)
+			}
+			waiting := dialog.NewCustom("Nextcloud 登录", "取消",
+				widget.NewLabel("请在浏览器中完成登录授权...\n"+flow.LoginURL), w)
+			waiting.SetOnClosed(cancel)
+			waiting.Show()
+			result, err := flow.Wait(ctx)
+			waiting.Hide()
+			if err != nil {
+				if ctx.Err() != context.Canceled {
+					dialog.ShowError(err, w)
+				}
+				return
+			}
+			if nameEntry.Text == "" {
+				nameEntry.SetText(result.Name)
+			}
+			urlEntry.SetText(result.URL)
+			authSelect.SetSelected("basic")
+			userEntry.SetText(result.User)
+			passEntry.SetText(result.Pass)
+			saved = false
+			form.OnSubmit()
+			if saved {
+				d.Hide()
+			}
+		}()
+	})
+
+	d = dialog.NewCustomConfirm("编辑账户", "保存", "取消", container.NewVBox(form, widget.NewAccordion(
+		widget.NewAccordionItem("TLS 设置", tlsForm),
+		widget.NewAccordionItem("代理设置", proxyForm),
+	), loginBtn), func(ok bool) {
+		if ok {
+			form.OnSubmit()
+		}
+	}, w)
+	d.Show()
+}
+
 // showConflictDialog 显示冲突解决对话框
-func showConflictDialog(w fyne.Window, conflict models.Conflict, logText *widget.Entry) {
+func showConflictDialog(w fyne.Window, profileName string, conflict models.Conflict, logText *widget.Entry) {
 	dialog.ShowCustomConfirm("解决冲突",
 		"",
 		"",
 		container.NewVBox(
-			widget.NewLabel(fmt.Sprintf("文件冲突: %s", conflict.File.Path)),
+			widget.NewLabel(fmt.Sprintf("文件冲突: [%s] %s", profileName, conflict.File.Path)),
 			widget.NewLabel("请选择解决方式:"),
 			container.NewHBox(
 				widget.NewButton("保留本地", func() {
@@ -227,4 +973,185 @@ func showConflictDialog(w fyne.Window, conflict models.Conflict, logText *widget
 			),
 		),
 		func(bool) {}, w)
+}
+
+// showDeleteConfirmDialog 显示批量删除确认对话框
+func showDeleteConfirmDialog(w fyne.Window, profileName string, confirm models.DeleteConfirmation, logText *widget.Entry, onDone func(confirmed bool)) {
+	paths := ""
+	for i, task := range confirm.Tasks {
+		if i == 10 {
+			paths += fmt.Sprintf("\n... 以及另外 %d 个文件", len(confirm.Tasks)-i)
+			break
+		}
+		paths += "\n" + task.Path
+	}
+	message := fmt.Sprintf("同步对 %s 本次将删除 %d 个文件（共跟踪 %d 个），已暂停该同步对。\n确认执行这些删除吗？%s",
+		profileName, len(confirm.Tasks), confirm.Total, paths)
+	dialog.ShowConfirm("确认批量删除", message, func(ok bool) {
+		confirm.Choice <- ok
+		if ok {
+			logText.SetText(logText.Text + fmt.Sprintf("\n已确认删除 %d 个文件", len(confirm.Tasks)))
+		} else {
+			logText.SetText(logText.Text + fmt.Sprintf("\n已取消删除 %d 个文件", len(confirm.Tasks)))
+		}
+		onDone(ok)
+	}, w)
+}
+
+// showSelectiveSyncDialog 以目录树显示云端子目录，勾选的目录才会同步到本地
+func showSelectiveSyncDialog(w fyne.Window, eng *engine.SyncEngine, db *db.DB, logText *widget.Entry) {
+	cfg, err := models.Load(db.DB, eng.ProfileID())
+	if err != nil {
+		dialog.ShowError(err, w)
+		return
+	}
+	excluded := make(map[string]bool)
+	for _, folder := range cfg.ExcludedFolders {
+		excluded[folder] = true
+	}
+	// parentExcluded 判断目录的某个上级目录是否已取消勾选
+	parentExcluded := func(folder string) bool {
+		for dir := path.Dir(folder); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if excluded[dir] {
+				return true
+			}
+		}
+		return false
+	}
+
+	children := make(map[string][]string)
+	var tree *widget.Tree
+	tree = widget.NewTree(
+		func(uid widget.TreeNodeID) []widget.TreeNodeID {
+			if folders, ok := children[uid]; ok {
+				return folders
+			}
+			folders, err := eng.ListRemoteFolders(uid)
+			if err != nil {
+				dialog.ShowError(err, w)
+				return nil
+			}
+			children[uid] = folders
+			return folders
+		},
+		func(uid widget.TreeNodeID) bool { return true },
+		func(bool) fyne.CanvasObject { return widget.NewCheck("", nil) },
+		func(uid widget.TreeNodeID, _ bool, o fyne.CanvasObject) {
+			check := o.(*widget.Check)
+			check.OnChanged = nil
+			check.Text = path.Base(uid)
+			check.SetChecked(!excluded[uid] && !parentExcluded(uid))
+			if parentExcluded(uid) {
+				check.Disable()
+			} else {
+				check.Enable()
+			}
+			check.OnChanged = func(checked bool) {
+				if checked {
+					delete(excluded, uid)
+				} else {
+					excluded[uid] = true
+				}
+				tree.Refresh()
+			}
+		},
+	)
+	content := container.NewStack(tree)
+
+	d := dialog.NewCustomConfirm("选择性同步", "保存", "取消", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		var folders []string
+		for folder := range excluded {
+			if !parentExcluded(folder) {
+				folders = append(folders, folder)
+			}
+		}
+		removed := eng.NewlyExcluded(folders)
+		cfg.ExcludedFolders = folders
+		if err := models.Save(db.DB, eng.ProfileID(), cfg); err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		eng.UpdateConfig(cfg)
+		logText.SetText(logText.Text + fmt.Sprintf("\n选择性同步已更新，排除 %d 个目录", len(folders)))
+		if len(removed) == 0 {
+			return
+		}
+		dialog.ShowConfirm("删除本地副本",
+			fmt.Sprintf("以下目录已取消勾选，是否将本地副本移入回收站？\n%s", strings.Join(removed, "\n")),
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := eng.RemoveLocalFolders(removed); err != nil {
+					dialog.ShowError(err, w)
+					return
+				}
+				logText.SetText(logText.Text + fmt.Sprintf("\n已移除 %d 个目录的本地副本", len(removed)))
+			}, w)
+	}, w)
+	d.Resize(fyne.NewSize(500, 500))
+	d.Show()
+}
+
+// showFilesDialog 显示已跟踪文件的同步状态，被过滤的文件同时显示跳过原因
+func showFilesDialog(w fyne.Window, db *db.DB, profileID int64) {
+	files, err := db.GetFiles(profileID)
+	if err != nil {
+		dialog.ShowError(err, w)
+		return
+	}
+	list := widget.NewList(
+		func() int { return len(files) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			file := files[i]
+			text := fmt.Sprintf("%s  [%s]", file.Path, file.Status)
+			if file.SkipReason != "" {
+				text += "  跳过原因：" + file.SkipReason
+			}
+			o.(*widget.Label).SetText(text)
+		},
+	)
+	content := container.NewStack(list)
+	d := dialog.NewCustom("文件列表", "关闭", content, w)
+	d.Resize(fyne.NewSize(600, 400))
+	d.Show()
+}
+
+// showTrashDialog 显示本地回收站，可将文件恢复到原位置
+func showTrashDialog(w fyne.Window, eng *engine.SyncEngine, logText *widget.Entry) {
+	entries, err := eng.TrashEntries()
+	if err != nil {
+		dialog.ShowError(err, w)
+		return
+	}
+	if len(entries) == 0 {
+		dialog.ShowInformation("回收站", "回收站为空", w)
+		return
+	}
+
+	var d dialog.Dialog
+	list := container.NewVBox()
+	for _, entry := range entries {
+		entry := entry
+		deletedAt := time.Unix(entry.DeletedAt, 0).Format("2006-01-02 15:04")
+		list.Add(container.NewBorder(nil, nil, nil,
+			widget.NewButton("恢复", func() {
+				if err := eng.RestoreTrash(entry.ID); err != nil {
+					dialog.ShowError(err, w)
+					return
+				}
+				logText.SetText(logText.Text + fmt.Sprintf("\n已从回收站恢复: %s", entry.Path))
+				d.Hide()
+			}),
+			widget.NewLabel(fmt.Sprintf("%s（%s 删除）", entry.Path, deletedAt)),
+		))
+	}
+	scroll := container.NewVScroll(list)
+	scroll.SetMinSize(fyne.NewSize(500, 300))
+	d = dialog.NewCustom("回收站", "关闭", scroll, w)
+	d.Show()
 }
\ No newline at end of file
@@ -4,7 +4,6 @@ import (
     "WebdavSync/db"
     "WebdavSync/engine"
     "WebdavSync/gui"
-    "WebdavSync/models" // 更新为 models
 )
 
 func main() {
@@ -15,15 +14,9 @@ func main() {
     }
     defer db.Close()
 
-    // 加载配置
-    cfg, err := models.Load(db.DB) // 使用 models.Load
-    if err != nil {
-        cfg = models.DefaultConfig()
-    }
-
-    // 初始化同步引擎
-    eng := engine.NewSyncEngine(cfg, db.DB)
+    // 初始化同步引擎管理器，各同步对的配置由管理器从数据库加载
+    mgr := engine.NewManager(db.DB)
 
     // 启动 GUI
-    gui.Run(eng, db)
+    gui.Run(mgr, db)
 }
\ No newline at end of file
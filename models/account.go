@@ -0,0 +1,210 @@
+package models
+
+import (
+    "database/sql"
+    "fmt"
+)
+
+// Account 存储一个 WebDAV 账户，可被多个同步对共用
+type Account struct {
+    ID       int64  // 账户 ID
+    Name     string // 显示名称
+    URL      string // WebDAV URL
+    AuthType string // 认证方式：basic（含应用密码）, digest, bearer, oauth2
+    User     string // 用户名
+    Pass     string // 密码或应用密码
+
+    Token        string // bearer 令牌，或 OAuth2 刷新令牌
+    TokenURL     string // OAuth2 令牌端点
+    ClientID     string // OAuth2 客户端 ID
+    ClientSecret string // OAuth2 客户端密钥
+
+    CACert     string // 自定义 CA 证书包（PEM）路径
+    ClientCert string // 双向 TLS 客户端证书（PEM）路径
+    ClientKey  string // 双向 TLS 客户端私钥（PEM）路径
+    PinSHA256  string // 服务器证书 SHA-256 指纹，非空时只信任该证书
+    Insecure   bool   // 跳过服务器证书校验，存在中间人攻击风险
+
+    ProxyMode string // 代理方式：system（环境变量）, manual, none
+    ProxyURL  string // 手动代理地址，例如 http://proxy.example.com:3128
+    ProxyUser string // 代理用户名
+    ProxyPass string // 代理密码
+}
+
+// secretField 是 accounts 表中需要加密保存的一列及其在 Account 中对应的字段
+type secretField struct {
+    column string
+    value  *string
+}
+
+// secrets 返回账户中需要加密保存的凭据
+func (a *Account) secrets() []secretField {
+    return []secretField{
+        {"pass", &a.Pass},
+        {"token", &a.Token},
+        {"client_secret", &a.ClientSecret},
+        {"proxy_pass", &a.ProxyPass},
+    }
+}
+
+const accountColumns = `id, name, url, auth_type, user, pass, token, token_url, client_id, client_secret,
+    ca_cert, client_cert, client_key, pin_sha256, insecure, proxy_mode, proxy_url, proxy_user, proxy_pass`
+
+// scanAccount 读取一行账户记录并还原加密保存的凭据
+func scanAccount(row interface{ Scan(...any) error }) (Account, error) {
+    var a Account
+    err := row.Scan(&a.ID, &a.Name, &a.URL, &a.AuthType, &a.User, &a.Pass, &a.Token, &a.TokenURL, &a.ClientID, &a.ClientSecret,
+        &a.CACert, &a.ClientCert, &a.ClientKey, &a.PinSHA256, &a.Insecure, &a.ProxyMode, &a.ProxyURL, &a.ProxyUser, &a.ProxyPass)
+    if err != nil {
+        return a, err
+    }
+    for _, secret := range a.secrets() {
+        if *secret.value, err = loadSecret(a.ID, secret.column, *secret.value); err != nil {
+            return a, err
+        }
+    }
+    return a, nil
+}
+
+// LoadAccounts 返回所有账户
+func LoadAccounts(db *sql.DB) ([]Account, error) {
+    rows, err := db.Query("SELECT " + accountColumns + " FROM accounts ORDER BY id")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var accounts []Account
+    for rows.Next() {
+        a, err := scanAccount(rows)
+        if err != nil {
+            return nil, err
+        }
+        accounts = append(accounts, a)
+    }
+    return accounts, nil
+}
+
+// LoadAccount 返回指定账户
+func LoadAccount(db *sql.DB, id int64) (Account, error) {
+    return scanAccount(db.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ?", id))
+}
+
+// SaveAccount 保存账户，ID 为 0 时新建并返回新 ID。凭据加密保存，不以明文写入数据库。
+// 新建账户时凭据保存失败不会留下账户记录
+func SaveAccount(db *sql.DB, a Account) (int64, error) {
+    if a.AuthType == "" {
+        a.AuthType = "basic"
+    }
+    if a.ProxyMode == "" {
+        a.ProxyMode = "system"
+    }
+    created := a.ID == 0
+    if created && vaultLocked() {
+        for _, secret := range a.secrets() {
+            if *secret.value != "" {
+                return 0, ErrVaultLocked
+            }
+        }
+    }
+    tx, err := db.Begin()
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+    if created {
+        res, err := tx.Exec("INSERT INTO accounts (name, url, user, pass) VALUES (?, ?, ?, '')", a.Name, a.URL, a.User)
+        if err != nil {
+            return 0, err
+        }
+        if a.ID, err = res.LastInsertId(); err != nil {
+            return 0, err
+        }
+    }
+    // 密钥环条目以账户 ID 命名，新建账户需先取得 ID
+    stored := a
+    err = func() error {
+        for _, secret := range stored.secrets() {
+            var err error
+            if *secret.value, err = storeSecret(a.ID, secret.column, *secret.value); err != nil {
+                return err
+            }
+        }
+        _, err := tx.Exec(`UPDATE accounts SET name = ?, url = ?, auth_type = ?, user = ?, pass = ?,
+                token = ?, token_url = ?, client_id = ?, client_secret = ?,
+                ca_cert = ?, client_cert = ?, client_key = ?, pin_sha256 = ?, insecure = ?,
+                proxy_mode = ?, proxy_url = ?, proxy_user = ?, proxy_pass = ? WHERE id = ?`,
+            stored.Name, stored.URL, stored.AuthType, stored.User, stored.Pass,
+            stored.Token, stored.TokenURL, stored.ClientID, stored.ClientSecret,
+            stored.CACert, stored.ClientCert, stored.ClientKey, stored.PinSHA256, stored.Insecure,
+            stored.ProxyMode, stored.ProxyURL, stored.ProxyUser, stored.ProxyPass, stored.ID)
+        if err != nil {
+            return err
+        }
+        return tx.Commit()
+    }()
+    if err == nil {
+        return a.ID, nil
+    }
+    if !created {
+        return a.ID, err
+    }
+    // 新建的账户记录已回滚，同时删除已写入密钥环的条目，新账户可能复用这个 ID
+    for _, secret := range stored.secrets() {
+        deleteSecret(a.ID, secret.column, *secret.value)
+    }
+    return 0, err
+}
+
+// SaveAccountToken 保存 OAuth2 刷新后的令牌
+func SaveAccountToken(db *sql.DB, id int64, token string) error {
+    stored, err := storeSecret(id, "token", token)
+    if err != nil {
+        return err
+    }
+    _, err = db.Exec("UPDATE accounts SET token = ? WHERE id = ?", stored, id)
+    return err
+}
+
+// AccountProfiles 返回使用该账户的同步对 ID
+func AccountProfiles(db *sql.DB, id int64) ([]int64, error) {
+    rows, err := db.Query("SELECT profile_id FROM config WHERE key = 'account_id' AND value = ?", fmt.Sprint(id))
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var ids []int64
+    for rows.Next() {
+        var profileID int64
+        if err := rows.Scan(&profileID); err != nil {
+            return nil, err
+        }
+        ids = append(ids, profileID)
+    }
+    return ids, nil
+}
+
+// DeleteAccount 删除账户，仍有同步对使用时返回错误
+func DeleteAccount(db *sql.DB, id int64) error {
+    profiles, err := AccountProfiles(db, id)
+    if err != nil {
+        return err
+    }
+    if len(profiles) > 0 {
+        return fmt.Errorf("账户仍被 %d 个同步对使用，无法删除", len(profiles))
+    }
+    var stored Account
+    err = db.QueryRow("SELECT pass, token, client_secret, proxy_pass FROM accounts WHERE id = ?", id).
+        Scan(&stored.Pass, &stored.Token, &stored.ClientSecret, &stored.ProxyPass)
+    if err != nil {
+        return err
+    }
+    for _, secret := range stored.secrets() {
+        if err := deleteSecret(id, secret.column, *secret.value); err != nil {
+            return err
+        }
+    }
+    _, err = db.Exec("DELETE FROM accounts WHERE id = ?", id)
+    return err
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// FilterRule 描述一条按大小、扩展名和修改时间过滤文件的规则
+type FilterRule struct {
+    PathPrefix string   // 规则作用的目录（相对于同步目录），空表示整个同步目录
+    MaxSize    int64    // 大于该字节数的文件不同步，0 表示不限制
+    Extensions []string // 只同步这些扩展名（小写，不含点），空表示不限制
+    MaxAgeDays int      // 超过该天数未修改的文件不同步，0 表示不限制
+}
+
+// ParseFilterRules 解析过滤规则文本，每行一条规则：
+//
+//    [/目录] max_size=2G ext=pdf,docx max_age=365
+//
+// 空行和以 # 开头的行会被忽略。
+func ParseFilterRules(text string) ([]FilterRule, error) {
+    var rules []FilterRule
+    for i, line := range strings.Split(text, "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        var rule FilterRule
+        for _, field := range strings.Fields(line) {
+            if strings.HasPrefix(field, "/") {
+                rule.PathPrefix = strings.Trim(field, "/")
+                continue
+            }
+            key, value, ok := strings.Cut(field, "=")
+            if !ok {
+                return nil, fmt.Errorf("第 %d 行：无法识别 %q", i+1, field)
+            }
+            switch key {
+            case "max_size":
+                size, err := ParseSize(value)
+                if err != nil {
+                    return nil, fmt.Errorf("第 %d 行：%v", i+1, err)
+                }
+                rule.MaxSize = size
+            case "ext":
+                for _, ext := range strings.Split(value, ",") {
+                    ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+                    if ext != "" {
+                        rule.Extensions = append(rule.Extensions, ext)
+                    }
+                }
+            case "max_age":
+                days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+                if err != nil || days < 0 {
+                    return nil, fmt.Errorf("第 %d 行：无效的天数 %q", i+1, value)
+                }
+                rule.MaxAgeDays = days
+            default:
+                return nil, fmt.Errorf("第 %d 行：未知条件 %q", i+1, key)
+            }
+        }
+        rules = append(rules, rule)
+    }
+    return rules, nil
+}
+
+// FormatFilterRules 将过滤规则转换为 ParseFilterRules 可解析的文本
+func FormatFilterRules(rules []FilterRule) string {
+    lines := make([]string, 0, len(rules))
+    for _, rule := range rules {
+        var fields []string
+        if rule.PathPrefix != "" {
+            fields = append(fields, "/"+rule.PathPrefix)
+        }
+        if rule.MaxSize > 0 {
+            fields = append(fields, "max_size="+FormatSize(rule.MaxSize))
+        }
+        if len(rule.Extensions) > 0 {
+            fields = append(fields, "ext="+strings.Join(rule.Extensions, ","))
+        }
+        if rule.MaxAgeDays > 0 {
+            fields = append(fields, "max_age="+strconv.Itoa(rule.MaxAgeDays))
+        }
+        lines = append(lines, strings.Join(fields, " "))
+    }
+    return strings.Join(lines, "\n")
+}
+
+var sizeUnits = []struct {
+    suffix string
+    size   int64
+}{
+    {"T", 1 << 40},
+    {"G", 1 << 30},
+    {"M", 1 << 20},
+    {"K", 1 << 10},
+}
+
+// ParseSize 解析带单位的大小，例如 512K、100M、2G
+func ParseSize(s string) (int64, error) {
+    value := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+    multiplier := int64(1)
+    for _, unit := range sizeUnits {
+        if strings.HasSuffix(value, unit.suffix) {
+            value = strings.TrimSuffix(value, unit.suffix)
+            multiplier = unit.size
+            break
+        }
+    }
+    n, err := strconv.ParseFloat(value, 64)
+    if err != nil || n < 0 {
+        return 0, fmt.Errorf("无效的大小 %q", s)
+    }
+    return int64(n * float64(multiplier)), nil
+}
+
+// FormatSize 将字节数格式化为 ParseSize 可解析的形式
+func FormatSize(size int64) string {
+    for _, unit := range sizeUnits {
+        if size >= unit.size && size%unit.size == 0 {
+            return strconv.FormatInt(size/unit.size, 10) + unit.suffix
+        }
+    }
+    return strconv.FormatInt(size, 10)
+}
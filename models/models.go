@@ -2,18 +2,55 @@ package models
 
 import (
     "database/sql"
+    "strconv"
+    "strings"
 )
 
 // Config 存储同步配置
 type Config struct {
-    URL       string // WebDAV URL
-    User      string // 用户名
-    Pass      string // 密码
+    AccountID int64  // 使用的 WebDAV 账户 ID
+    URL       string // WebDAV URL，加载时从账户读取
+    User      string // 用户名，加载时从账户读取
+    Pass      string // 密码，加载时从账户读取
     LocalDir  string // 本地同步目录
     RemoteDir string // 云端同步目录
     Mode      string // 同步模式：bidirectional, source-to-target, target-to-source
+    TrashDays int    // 本地回收站保留天数，0 表示永久保留
+
+    RemoteVersions bool // 覆盖或删除云端文件前将旧版本移入 .versions/
+    VersionDays    int  // 云端历史版本保留天数，0 表示永久保留
+
+    MaxDeletes       int // 单个同步周期内允许的最大删除数，超过需确认，0 表示不限制
+    MaxDeletePercent int // 单个同步周期内允许删除的文件百分比，超过需确认，0 表示不限制
+
+    IgnorePatterns string       // 全局忽略规则，gitignore 语法，每行一条
+    Filters        []FilterRule // 按大小、扩展名和修改时间过滤文件的规则
+
+    ExcludedFolders []string // 选择性同步中未勾选的云端子目录（相对于云端同步目录）
+
+    PollInterval    int // 轮询云端的基础间隔（秒）
+    MaxPollInterval int // 云端长时间无变化时轮询间隔的上限（秒）
+
+    Push bool // 使用 Nextcloud notify_push 接收云端变更通知，不可用时回退到轮询
+
+    RescanInterval int // 定期重新扫描本地目录的间隔（分钟），0 表示只在启动和监控丢失事件时扫描
+
+    HashAlgorithm string // 本地文件哈希算法，见 HashAlgorithms
 }
 
+// HashAlgorithms 是支持的本地文件哈希算法，sha1 与旧版本记录的哈希兼容
+var HashAlgorithms = []string{"sha1", "sha256", "blake3", "xxhash"}
+
+// DefaultIgnorePatterns 是默认的全局忽略规则
+const DefaultIgnorePatterns = `.DS_Store
+Thumbs.db
+desktop.ini
+~$*
+*.swp
+*.tmp
+.~lock.*#
+node_modules/`
+
 // DefaultConfig 返回默认配置
 func DefaultConfig() Config {
     return Config{
@@ -23,13 +60,29 @@ func DefaultConfig() Config {
         LocalDir:  "",
         RemoteDir: "",
         Mode:      "bidirectional",
+        TrashDays: 30,
+
+        RemoteVersions: false,
+        VersionDays:    30,
+
+        MaxDeletes:       50,
+        MaxDeletePercent: 30,
+
+        IgnorePatterns: DefaultIgnorePatterns,
+
+        PollInterval:    10,
+        MaxPollInterval: 300,
+
+        RescanInterval: 60,
+
+        HashAlgorithm: "sha1",
     }
 }
 
-// Load 从数据库加载配置
-func Load(db *sql.DB) (Config, error) {
+// Load 从数据库加载同步对的配置
+func Load(db *sql.DB, profileID int64) (Config, error) {
     cfg := DefaultConfig()
-    rows, err := db.Query("SELECT key, value FROM config")
+    rows, err := db.Query("SELECT key, value FROM config WHERE profile_id = ?", profileID)
     if err != nil {
         return cfg, err
     }
@@ -41,77 +94,153 @@ func Load(db *sql.DB) (Config, error) {
             return cfg, err
         }
         switch key {
-        case "url":
-            cfg.URL = value
-        case "user":
-            cfg.User = value
-        case "pass":
-            cfg.Pass = value
+        case "account_id":
+            if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+                cfg.AccountID = n
+            }
         case "local_dir":
             cfg.LocalDir = value
         case "remote_dir":
             cfg.RemoteDir = value
         case "mode":
             cfg.Mode = value
+        case "trash_days":
+            if n, err := strconv.Atoi(value); err == nil {
+                cfg.TrashDays = n
+            }
+        case "remote_versions":
+            cfg.RemoteVersions = value == "true"
+        case "version_days":
+            if n, err := strconv.Atoi(value); err == nil {
+                cfg.VersionDays = n
+            }
+        case "max_deletes":
+            if n, err := strconv.Atoi(value); err == nil {
+                cfg.MaxDeletes = n
+            }
+        case "max_delete_percent":
+            if n, err := strconv.Atoi(value); err == nil {
+                cfg.MaxDeletePercent = n
+            }
+        case "ignore_patterns":
+            cfg.IgnorePatterns = value
+        case "filter_rules":
+            if rules, err := ParseFilterRules(value); err == nil {
+                cfg.Filters = rules
+            }
+        case "excluded_folders":
+            cfg.ExcludedFolders = splitLines(value)
+        case "poll_interval":
+            if n, err := strconv.Atoi(value); err == nil {
+                cfg.PollInterval = n
+            }
+        case "max_poll_interval":
+            if n, err := strconv.Atoi(value); err == nil {
+                cfg.MaxPollInterval = n
+            }
+        case "push":
+            cfg.Push = value == "true"
+        case "rescan_interval":
+            if n, err := strconv.Atoi(value); err == nil {
+                cfg.RescanInterval = n
+            }
+        case "hash_algorithm":
+            cfg.HashAlgorithm = value
         }
     }
-    return cfg, nil
-}
-
-// Save 保存配置到数据库
-func Save(db *sql.DB, cfg Config) error {
-    tx, err := db.Begin()
-    if err != nil {
-        return err
+    if err := rows.Err(); err != nil {
+        return cfg, err
     }
-    defer tx.Rollback()
+    return cfg, cfg.ApplyAccount(db)
+}
 
-    upsert := `INSERT OR REPLACE INTO config (key, value) VALUES (?, ?)`
-    _, err = tx.Exec(upsert, "url", cfg.URL)
-    if err != nil {
-        return err
+// ApplyAccount 从 accounts 表读取账户凭据填入配置，未选择账户时清空凭据
+func (cfg *Config) ApplyAccount(db *sql.DB) error {
+    cfg.URL, cfg.User, cfg.Pass = "", "", ""
+    if cfg.AccountID == 0 {
+        return nil
     }
-    _, err = tx.Exec(upsert, "user", cfg.User)
-    if err != nil {
-        return err
+    account, err := LoadAccount(db, cfg.AccountID)
+    if err == sql.ErrNoRows {
+        cfg.AccountID = 0
+        return nil
     }
-    _, err = tx.Exec(upsert, "pass", cfg.Pass)
     if err != nil {
         return err
     }
-    _, err = tx.Exec(upsert, "local_dir", cfg.LocalDir)
+    cfg.URL, cfg.User, cfg.Pass = account.URL, account.User, account.Pass
+    return nil
+}
+
+// Save 保存同步对的配置到数据库
+func Save(db *sql.DB, profileID int64, cfg Config) error {
+    tx, err := db.Begin()
     if err != nil {
         return err
     }
-    _, err = tx.Exec(upsert, "remote_dir", cfg.RemoteDir)
-    if err != nil {
-        return err
+    defer tx.Rollback()
+
+    upsert := `INSERT OR REPLACE INTO config (profile_id, key, value) VALUES (?, ?, ?)`
+    values := [][2]string{
+        {"account_id", strconv.FormatInt(cfg.AccountID, 10)},
+        {"local_dir", cfg.LocalDir},
+        {"remote_dir", cfg.RemoteDir},
+        {"mode", cfg.Mode},
+        {"trash_days", strconv.Itoa(cfg.TrashDays)},
+        {"remote_versions", strconv.FormatBool(cfg.RemoteVersions)},
+        {"version_days", strconv.Itoa(cfg.VersionDays)},
+        {"max_deletes", strconv.Itoa(cfg.MaxDeletes)},
+        {"max_delete_percent", strconv.Itoa(cfg.MaxDeletePercent)},
+        {"ignore_patterns", cfg.IgnorePatterns},
+        {"filter_rules", FormatFilterRules(cfg.Filters)},
+        {"excluded_folders", strings.Join(cfg.ExcludedFolders, "\n")},
+        {"poll_interval", strconv.Itoa(cfg.PollInterval)},
+        {"max_poll_interval", strconv.Itoa(cfg.MaxPollInterval)},
+        {"push", strconv.FormatBool(cfg.Push)},
+        {"rescan_interval", strconv.Itoa(cfg.RescanInterval)},
+        {"hash_algorithm", cfg.HashAlgorithm},
     }
-    _, err = tx.Exec(upsert, "mode", cfg.Mode)
-    if err != nil {
-        return err
+    for _, kv := range values {
+        if _, err := tx.Exec(upsert, profileID, kv[0], kv[1]); err != nil {
+            return err
+        }
     }
 
     return tx.Commit()
 }
 
+// splitLines 将多行文本拆分为非空行
+func splitLines(text string) []string {
+    var lines []string
+    for _, line := range strings.Split(text, "\n") {
+        if line = strings.TrimSpace(line); line != "" {
+            lines = append(lines, line)
+        }
+    }
+    return lines
+}
+
 // FileInfo 存储文件同步信息
 type FileInfo struct {
+    ProfileID   int64  // 所属同步对 ID
     Path        string // 文件路径（相对于同步目录）
-    LocalHash   string // 本地文件哈希
+    LocalHash   string // 本地文件哈希，非 sha1 算法带有 "算法:" 前缀
     RemoteHash  string // 云端文件哈希
     LocalMtime  int64  // 本地修改时间（Unix 时间戳）
+    LocalSize   int64  // 本地文件大小，用于重新扫描时判断文件是否可能已变化
     RemoteMtime int64  // 云端修改时间（Unix 时间戳）
     LastSync    int64  // 最后同步时间（Unix 时间戳）
-    Status      string // 状态：synced, local_modified, remote_modified, local_deleted, remote_deleted
+    Status      string // 状态：synced, local_modified, remote_modified, local_deleted, remote_deleted, skipped
+    SkipReason  string // 被过滤规则跳过的原因
 }
 
 // Task 存储同步任务
 type Task struct {
     ID          int64  // 任务 ID
+    ProfileID   int64  // 所属同步对 ID
     Path        string // 文件路径
     Operation   string // 操作：upload, download, delete_local, delete_remote
-    Status      string // 状态：pending, completed, failed
+    Status      string // 状态：pending, held, completed, failed, cancelled
     Retries     int    // 重试次数
     LastAttempt int64  // 最后尝试时间（Unix 时间戳）
     ChunkOffset int64  // 分片上传偏移量
@@ -119,6 +248,25 @@ type Task struct {
 
 // Conflict 表示文件冲突
 type Conflict struct {
-    File   FileInfo
-    Choice chan string // 解决方式：local, remote, ignore
+    ProfileID int64 // 所属同步对 ID
+    File      FileInfo
+    Choice    chan string // 解决方式：local, remote, ignore
+}
+
+// DeleteConfirmation 表示超过阈值、等待用户确认的批量删除
+type DeleteConfirmation struct {
+    ProfileID int64     // 所属同步对 ID
+    Tasks     []Task    // 被暂缓的删除任务
+    Total     int       // 当前跟踪的文件总数
+    Choice    chan bool // true 表示确认删除，false 表示取消
+}
+
+// TrashEntry 表示本地回收站中的一个文件
+type TrashEntry struct {
+    ID        int64  // 记录 ID
+    ProfileID int64  // 所属同步对 ID
+    Path      string // 原始路径（相对于同步目录）
+    TrashPath string // 回收站中的路径（相对于回收站目录）
+    DeletedAt int64  // 删除时间（Unix 时间戳）
+    Size      int64  // 文件大小
 }
\ No newline at end of file
@@ -0,0 +1,68 @@
+package models
+
+import (
+    "database/sql"
+)
+
+// Profile 表示一个同步对
+type Profile struct {
+    ID   int64  // 同步对 ID
+    Name string // 显示名称
+}
+
+// LoadProfiles 返回所有同步对
+func LoadProfiles(db *sql.DB) ([]Profile, error) {
+    rows, err := db.Query("SELECT id, name FROM profiles ORDER BY id")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var profiles []Profile
+    for rows.Next() {
+        var p Profile
+        if err := rows.Scan(&p.ID, &p.Name); err != nil {
+            return nil, err
+        }
+        profiles = append(profiles, p)
+    }
+    return profiles, nil
+}
+
+// CreateProfile 新建同步对并保存其配置
+func CreateProfile(db *sql.DB, name string, cfg Config) (int64, error) {
+    res, err := db.Exec("INSERT INTO profiles (name) VALUES (?)", name)
+    if err != nil {
+        return 0, err
+    }
+    id, err := res.LastInsertId()
+    if err != nil {
+        return 0, err
+    }
+    return id, Save(db, id, cfg)
+}
+
+// RenameProfile 修改同步对名称
+func RenameProfile(db *sql.DB, id int64, name string) error {
+    _, err := db.Exec("UPDATE profiles SET name = ? WHERE id = ?", name, id)
+    return err
+}
+
+// DeleteProfile 删除同步对及其配置、文件状态、哈希缓存、块签名、任务和回收站记录
+func DeleteProfile(db *sql.DB, id int64) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    for _, table := range []string{"config", "files", "hash_cache", "block_signatures", "tasks", "trash"} {
+        if _, err := tx.Exec("DELETE FROM "+table+" WHERE profile_id = ?", id); err != nil {
+            return err
+        }
+    }
+    if _, err := tx.Exec("DELETE FROM profiles WHERE id = ?", id); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
@@ -0,0 +1,251 @@
+package models
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// 计划时段的同步方式
+const (
+    SchedulePause = "pause" // 暂停同步
+    ScheduleLimit = "limit" // 按规则中的速率限速
+    ScheduleFull  = "full"  // 不限速
+)
+
+// ScheduleRule 描述一个按星期和时间生效的同步时段
+type ScheduleRule struct {
+    Days     [7]bool // 按 time.Weekday 索引，规则生效的星期
+    Start    int     // 开始时间，自零点起的分钟数
+    End      int     // 结束时间，自零点起的分钟数，不大于 Start 时表示跨越午夜，到次日结束
+    Mode     string  // pause、limit 或 full
+    Upload   int64   // limit 模式的上传限速（KB/s），0 表示不限速
+    Download int64   // limit 模式的下载限速（KB/s），0 表示不限速
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseSchedule 解析计划文本，每行一条规则：
+//
+//    mon-fri 09:00-18:00 limit up=200 down=1000
+//    sat,sun 12:00-13:00 pause
+//    * 00:00-06:00 full
+//
+// 第一列为星期（* 表示每天），第二列为时间段，第三列为同步方式。
+// 跨越午夜的时间段属于开始的那一天。多条规则重叠时前面的优先。
+// 空行和以 # 开头的行会被忽略。
+func ParseSchedule(text string) ([]ScheduleRule, error) {
+    var rules []ScheduleRule
+    for i, line := range strings.Split(text, "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        fields := strings.Fields(line)
+        if len(fields) < 3 {
+            return nil, fmt.Errorf("第 %d 行：格式应为“星期 开始-结束 方式”", i+1)
+        }
+        var rule ScheduleRule
+        var err error
+        if rule.Days, err = parseDays(fields[0]); err != nil {
+            return nil, fmt.Errorf("第 %d 行：%v", i+1, err)
+        }
+        start, end, ok := strings.Cut(fields[1], "-")
+        if !ok {
+            return nil, fmt.Errorf("第 %d 行：无效的时间段 %q", i+1, fields[1])
+        }
+        if rule.Start, err = parseClock(start); err != nil {
+            return nil, fmt.Errorf("第 %d 行：%v", i+1, err)
+        }
+        if rule.End, err = parseClock(end); err != nil {
+            return nil, fmt.Errorf("第 %d 行：%v", i+1, err)
+        }
+        rule.Mode = strings.ToLower(fields[2])
+        switch rule.Mode {
+        case SchedulePause, ScheduleLimit, ScheduleFull:
+        default:
+            return nil, fmt.Errorf("第 %d 行：未知的同步方式 %q", i+1, fields[2])
+        }
+        for _, field := range fields[3:] {
+            key, value, ok := strings.Cut(field, "=")
+            if !ok || rule.Mode != ScheduleLimit {
+                return nil, fmt.Errorf("第 %d 行：无法识别 %q", i+1, field)
+            }
+            rate, err := strconv.ParseInt(value, 10, 64)
+            if err != nil || rate < 0 {
+                return nil, fmt.Errorf("第 %d 行：无效的速率 %q", i+1, value)
+            }
+            switch key {
+            case "up":
+                rule.Upload = rate
+            case "down":
+                rule.Download = rate
+            default:
+                return nil, fmt.Errorf("第 %d 行：未知条件 %q", i+1, key)
+            }
+        }
+        rules = append(rules, rule)
+    }
+    return rules, nil
+}
+
+// parseDays 解析 mon-fri、sat,sun 或 * 形式的星期
+func parseDays(text string) ([7]bool, error) {
+    var days [7]bool
+    if text == "*" {
+        for i := range days {
+            days[i] = true
+        }
+        return days, nil
+    }
+    for _, part := range strings.Split(strings.ToLower(text), ",") {
+        first, last, isRange := strings.Cut(part, "-")
+        from, ok := weekday(first)
+        if !ok {
+            return days, fmt.Errorf("无效的星期 %q", first)
+        }
+        to := from
+        if isRange {
+            if to, ok = weekday(last); !ok {
+                return days, fmt.Errorf("无效的星期 %q", last)
+            }
+        }
+        // 范围可以跨越周末，例如 fri-mon
+        for d := from; ; d = (d + 1) % 7 {
+            days[d] = true
+            if d == to {
+                break
+            }
+        }
+    }
+    return days, nil
+}
+
+func weekday(name string) (int, bool) {
+    for i, n := range weekdayNames {
+        if name == n {
+            return i, true
+        }
+    }
+    return 0, false
+}
+
+// parseClock 解析 HH:MM 形式的时间，允许 24:00 表示一天结束
+func parseClock(text string) (int, error) {
+    t, err := time.Parse("15:04", text)
+    if err == nil {
+        return t.Hour()*60 + t.Minute(), nil
+    }
+    if text == "24:00" {
+        return 24 * 60, nil
+    }
+    return 0, fmt.Errorf("无效的时间 %q", text)
+}
+
+// FormatSchedule 将计划规则转换为 ParseSchedule 可解析的文本
+func FormatSchedule(rules []ScheduleRule) string {
+    lines := make([]string, 0, len(rules))
+    for _, rule := range rules {
+        fields := []string{
+            formatDays(rule.Days),
+            formatClock(rule.Start) + "-" + formatClock(rule.End),
+            rule.Mode,
+        }
+        if rule.Mode == ScheduleLimit {
+            if rule.Upload > 0 {
+                fields = append(fields, "up="+strconv.FormatInt(rule.Upload, 10))
+            }
+            if rule.Download > 0 {
+                fields = append(fields, "down="+strconv.FormatInt(rule.Download, 10))
+            }
+        }
+        lines = append(lines, strings.Join(fields, " "))
+    }
+    return strings.Join(lines, "\n")
+}
+
+// formatDays 从周一开始列出星期，连续三天以上合并为范围，例如 mon-fri,sun
+func formatDays(days [7]bool) string {
+    order := []int{1, 2, 3, 4, 5, 6, 0}
+    var parts []string
+    for i := 0; i < len(order); i++ {
+        if !days[order[i]] {
+            continue
+        }
+        j := i
+        for j+1 < len(order) && days[order[j+1]] {
+            j++
+        }
+        switch {
+        case i == 0 && j == len(order)-1:
+            return "*"
+        case j-i >= 2:
+            parts = append(parts, weekdayNames[order[i]]+"-"+weekdayNames[order[j]])
+        default:
+            for k := i; k <= j; k++ {
+                parts = append(parts, weekdayNames[order[k]])
+            }
+        }
+        i = j
+    }
+    return strings.Join(parts, ",")
+}
+
+func formatClock(minutes int) string {
+    return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// String 返回规则的星期和时间段，例如 sat,sun 12:00-13:00
+func (r ScheduleRule) String() string {
+    return formatDays(r.Days) + " " + formatClock(r.Start) + "-" + formatClock(r.End)
+}
+
+// covers 判断规则在 t 时刻是否生效
+func (r ScheduleRule) covers(t time.Time) bool {
+    minute := t.Hour()*60 + t.Minute()
+    today := int(t.Weekday())
+    switch {
+    case r.Start == r.End:
+        return r.Days[today]
+    case r.Start < r.End:
+        return r.Days[today] && minute >= r.Start && minute < r.End
+    }
+    // 跨越午夜：开始当天的后半段，或前一天开始的规则在今天的前半段
+    return (r.Days[today] && minute >= r.Start) || (r.Days[(today+6)%7] && minute < r.End)
+}
+
+// ActiveSchedule 返回 t 时刻生效的规则下标，没有规则生效时返回 -1
+func ActiveSchedule(rules []ScheduleRule, t time.Time) int {
+    for i, rule := range rules {
+        if rule.covers(t) {
+            return i
+        }
+    }
+    return -1
+}
+
+// NextScheduleChange 返回 now 之后生效规则第一次变化的时间，一周内不会变化时返回零值
+func NextScheduleChange(rules []ScheduleRule, now time.Time) time.Time {
+    if len(rules) == 0 {
+        return time.Time{}
+    }
+    // 生效规则只可能在某条规则的起止时间或零点（星期变化）时改变
+    var candidates []time.Time
+    for d := 0; d <= 8; d++ {
+        day := time.Date(now.Year(), now.Month(), now.Day()+d, 0, 0, 0, 0, now.Location())
+        candidates = append(candidates, day)
+        for _, rule := range rules {
+            candidates = append(candidates, day.Add(time.Duration(rule.Start)*time.Minute), day.Add(time.Duration(rule.End)*time.Minute))
+        }
+    }
+    sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+    current := ActiveSchedule(rules, now)
+    for _, t := range candidates {
+        if t.After(now) && ActiveSchedule(rules, t) != current {
+            return t
+        }
+    }
+    return time.Time{}
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+    "database/sql"
+    "strconv"
+)
+
+// Settings 是对所有同步对生效的全局设置
+type Settings struct {
+    UploadLimit   int64          // 上传限速（KB/s），所有同步对共享，0 表示不限速
+    DownloadLimit int64          // 下载限速（KB/s），所有同步对共享，0 表示不限速
+    Schedule      []ScheduleRule // 按时段暂停、限速或全速同步，不在任何时段内时使用上面的限速
+}
+
+// LoadSettings 从数据库加载全局设置
+func LoadSettings(db *sql.DB) (Settings, error) {
+    var s Settings
+    rows, err := db.Query("SELECT key, value FROM settings")
+    if err != nil {
+        return s, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var key, value string
+        if err := rows.Scan(&key, &value); err != nil {
+            return s, err
+        }
+        switch key {
+        case "upload_limit":
+            if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+                s.UploadLimit = n
+            }
+        case "download_limit":
+            if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+                s.DownloadLimit = n
+            }
+        case "schedule":
+            if rules, err := ParseSchedule(value); err == nil {
+                s.Schedule = rules
+            }
+        }
+    }
+    return s, rows.Err()
+}
+
+// SaveSettings 保存全局设置到数据库
+func SaveSettings(db *sql.DB, s Settings) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    upsert := `INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)`
+    values := [][2]string{
+        {"upload_limit", strconv.FormatInt(s.UploadLimit, 10)},
+        {"download_limit", strconv.FormatInt(s.DownloadLimit, 10)},
+        {"schedule", FormatSchedule(s.Schedule)},
+    }
+    for _, kv := range values {
+        if _, err := tx.Exec(upsert, kv[0], kv[1]); err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
+}
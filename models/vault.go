@@ -0,0 +1,270 @@
+package models
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "database/sql"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+    "sync"
+
+    "github.com/zalando/go-keyring"
+    "golang.org/x/crypto/argon2"
+)
+
+// ErrVaultLocked 表示凭据已加密保存，需要先输入主密码解锁
+var ErrVaultLocked = errors.New("凭据已锁定，请先输入主密码")
+
+// ErrWrongPassphrase 表示主密码错误
+var ErrWrongPassphrase = errors.New("主密码错误")
+
+const (
+    keyringService = "WebdavSync"
+    keyringPrefix  = "keyring:" // 密码保存在系统密钥环中
+    sealedPrefix   = "aesgcm:"  // 密码使用主密码派生的密钥加密
+    vaultCheck     = "WebdavSync vault"
+)
+
+// vault 保存凭据存储的运行状态：系统密钥环是否可用，以及主密码派生的密钥
+var vault struct {
+    mu      sync.Mutex
+    probed  bool
+    keyring bool
+    key     []byte
+}
+
+// keyringAvailable 探测系统密钥环（Secret Service、钥匙串或凭据管理器）是否可用
+func keyringAvailable() bool {
+    if !vault.probed {
+        vault.probed = true
+        vault.keyring = keyring.Set(keyringService, "probe", "probe") == nil &&
+            keyring.Delete(keyringService, "probe") == nil
+    }
+    return vault.keyring
+}
+
+// InitVault 初始化凭据存储。系统密钥环可用时立即将明文密码迁移到密钥环；
+// 返回 true 表示仍需输入或设置主密码才能读取和保存密码
+func InitVault(db *sql.DB) (bool, error) {
+    vault.mu.Lock()
+    useKeyring := keyringAvailable()
+    unlocked := vault.key != nil
+    vault.mu.Unlock()
+    if unlocked {
+        return false, nil
+    }
+    if !useKeyring {
+        return true, nil
+    }
+    // 之前没有密钥环时加密保存的密码仍需主密码解锁
+    var sealed int
+    if err := db.QueryRow("SELECT COUNT(*) FROM accounts WHERE pass LIKE ?", sealedPrefix+"%").Scan(&sealed); err != nil {
+        return false, err
+    }
+    if sealed > 0 {
+        return true, nil
+    }
+    return false, migratePlaintext(db)
+}
+
+// HasPassphrase 判断是否已设置主密码
+func HasPassphrase(db *sql.DB) (bool, error) {
+    var n int
+    err := db.QueryRow("SELECT COUNT(*) FROM vault WHERE key = 'salt'").Scan(&n)
+    return n > 0, err
+}
+
+// Unlock 使用主密码解锁凭据，首次调用时以该密码创建主密钥，随后迁移明文密码
+func Unlock(db *sql.DB, passphrase string) error {
+    salt, check, err := loadVaultParams(db)
+    if err != nil {
+        return err
+    }
+    if salt == nil {
+        salt = make([]byte, 16)
+        if _, err := rand.Read(salt); err != nil {
+            return err
+        }
+        key := deriveKey(passphrase, salt)
+        sealed, err := seal(key, vaultCheck)
+        if err != nil {
+            return err
+        }
+        _, err = db.Exec("INSERT OR REPLACE INTO vault (key, value) VALUES ('salt', ?), ('check', ?)",
+            base64.StdEncoding.EncodeToString(salt), sealed)
+        if err != nil {
+            return err
+        }
+        check = sealed
+    }
+    key := deriveKey(passphrase, salt)
+    if plain, err := open(key, check); err != nil || plain != vaultCheck {
+        return ErrWrongPassphrase
+    }
+    vault.mu.Lock()
+    vault.key = key
+    vault.mu.Unlock()
+    return migratePlaintext(db)
+}
+
+func loadVaultParams(db *sql.DB) (salt []byte, check string, err error) {
+    rows, err := db.Query("SELECT key, value FROM vault")
+    if err != nil {
+        return nil, "", err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var key, value string
+        if err := rows.Scan(&key, &value); err != nil {
+            return nil, "", err
+        }
+        switch key {
+        case "salt":
+            if salt, err = base64.StdEncoding.DecodeString(value); err != nil {
+                return nil, "", err
+            }
+        case "check":
+            check = value
+        }
+    }
+    return salt, check, rows.Err()
+}
+
+// deriveKey 使用 Argon2id 从主密码派生 AES-256 密钥
+func deriveKey(passphrase string, salt []byte) []byte {
+    return argon2.IDKey([]byte(passphrase), salt, 1, 64*1024, 4, 32)
+}
+
+func seal(key []byte, plain string) (string, error) {
+    gcm, err := newGCM(key)
+    if err != nil {
+        return "", err
+    }
+    nonce := make([]byte, gcm.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return "", err
+    }
+    data := gcm.Seal(nonce, nonce, []byte(plain), nil)
+    return sealedPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func open(key []byte, sealed string) (string, error) {
+    data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, sealedPrefix))
+    if err != nil {
+        return "", err
+    }
+    gcm, err := newGCM(key)
+    if err != nil {
+        return "", err
+    }
+    if len(data) < gcm.NonceSize() {
+        return "", fmt.Errorf("密文长度无效")
+    }
+    plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+    return string(plain), err
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
+
+// keyringUser 返回账户某项凭据在系统密钥环中的条目名，密码沿用不带后缀的名称
+func keyringUser(accountID int64, field string) string {
+    name := "account-" + strconv.FormatInt(accountID, 10)
+    if field != "pass" {
+        name += "-" + field
+    }
+    return name
+}
+
+// storeSecret 保存账户的一项凭据，优先使用系统密钥环，返回写入 accounts 表对应列的值
+func storeSecret(accountID int64, field, value string) (string, error) {
+    if value == "" {
+        return "", nil
+    }
+    vault.mu.Lock()
+    defer vault.mu.Unlock()
+    if keyringAvailable() {
+        if err := keyring.Set(keyringService, keyringUser(accountID, field), value); err != nil {
+            return "", err
+        }
+        return keyringPrefix, nil
+    }
+    if vault.key == nil {
+        return "", ErrVaultLocked
+    }
+    return seal(vault.key, value)
+}
+
+// vaultLocked 判断凭据当前是否无法保存：系统密钥环不可用且尚未输入主密码
+func vaultLocked() bool {
+    vault.mu.Lock()
+    defer vault.mu.Unlock()
+    return !keyringAvailable() && vault.key == nil
+}
+
+// loadSecret 将 accounts 表中保存的值还原为明文凭据，未迁移的旧值按明文返回
+func loadSecret(accountID int64, field, stored string) (string, error) {
+    vault.mu.Lock()
+    defer vault.mu.Unlock()
+    switch {
+    case stored == keyringPrefix:
+        return keyring.Get(keyringService, keyringUser(accountID, field))
+    case strings.HasPrefix(stored, sealedPrefix):
+        if vault.key == nil {
+            return "", ErrVaultLocked
+        }
+        return open(vault.key, stored)
+    }
+    return stored, nil
+}
+
+// deleteSecret 删除账户某项凭据在系统密钥环中的条目
+func deleteSecret(accountID int64, field, stored string) error {
+    if stored != keyringPrefix {
+        return nil
+    }
+    err := keyring.Delete(keyringService, keyringUser(accountID, field))
+    if errors.Is(err, keyring.ErrNotFound) {
+        return nil
+    }
+    return err
+}
+
+// migratePlaintext 将 accounts 表中仍以明文保存的密码改为加密保存
+func migratePlaintext(db *sql.DB) error {
+    rows, err := db.Query("SELECT id, pass FROM accounts WHERE pass != '' AND pass != ? AND pass NOT LIKE ?", keyringPrefix, sealedPrefix+"%")
+    if err != nil {
+        return err
+    }
+    plain := make(map[int64]string)
+    for rows.Next() {
+        var id int64
+        var pass string
+        if err := rows.Scan(&id, &pass); err != nil {
+            rows.Close()
+            return err
+        }
+        plain[id] = pass
+    }
+    rows.Close()
+
+    for id, pass := range plain {
+        stored, err := storeSecret(id, "pass", pass)
+        if err != nil {
+            return err
+        }
+        if _, err := db.Exec("UPDATE accounts SET pass = ? WHERE id = ?", stored, id); err != nil {
+            return err
+        }
+    }
+    return nil
+}